@@ -0,0 +1,107 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// SignBody returns a token that is only valid for a request with exactly
+// this body, e.g. the JSON a confirmation page submits, so that the payload
+// can't be swapped once the user confirmed it. The token is bound to the
+// session of c if SessionKey is set, signed with the key of KeyFunc and
+// DeriveSessionKeys like other signed tokens, and expires after
+// TokenMaxAge, or CookieMaxAge if unset. Validate it with RequireBodyToken.
+// Requires Secret or KeyFunc.
+func SignBody(c *fiber.Ctx, config Config, body []byte) (string, error) {
+	cfg := configDefault(config)
+	if len(cfg.Secret) == 0 && cfg.KeyFunc == nil {
+		return "", errors.New("csrf: SignBody requires Secret or KeyFunc")
+	}
+	key, err := bodyKey(c, cfg)
+	if err != nil {
+		return "", err
+	}
+	return generateHMACToken(cfg.RandReader, key, bodySession(c, cfg, body), nil, cfg.Now())
+}
+
+// RequireBodyToken returns a handler that requires a token from SignBody in
+// TokenLookup, validated by hashing the raw request body. Bodies larger
+// than maxSize bytes are rejected with 413 Request Entity Too Large before
+// hashing. Multipart bodies are parsed by the server before handlers run
+// and can't be hashed as sent; use it with JSON or urlencoded bodies.
+func RequireBodyToken(config Config, maxSize int) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	if len(cfg.Secret) == 0 && cfg.KeyFunc == nil {
+		panic("csrf: RequireBodyToken requires Secret or KeyFunc")
+	}
+	extractor := newExtractor(cfg.TokenLookup, cfg.RequireAllSources, cfg.MaxSourceAttempts, cfg.DuplicateTokenFields)
+	return func(c *fiber.Ctx) {
+		body := c.Fasthttp.Request.Body()
+		if len(body) > maxSize {
+			c.SendStatus(fiber.StatusRequestEntityTooLarge)
+			return
+		}
+		token, err := extractor(c)
+		if err != nil {
+			c.SendStatus(fiber.StatusBadRequest)
+			return
+		}
+		key, err := bodyKey(c, cfg)
+		if err != nil {
+			// Fail closed if the signing key is unavailable
+			c.SendStatus(fiber.StatusServiceUnavailable)
+			return
+		}
+		if !verifyHMACToken(key, bodySession(c, cfg, body), token) || bodyTokenExpired(cfg, token) {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// bodyKey returns the key body tokens of the request are signed with,
+// resolved as for ModeHMAC.
+func bodyKey(c *fiber.Ctx, cfg Config) ([]byte, error) {
+	key := cfg.Secret
+	if cfg.KeyFunc != nil {
+		var err error
+		if key, err = cfg.KeyFunc(c); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.DeriveSessionKeys && cfg.SessionKey != nil {
+		key = deriveKey(key, cfg.SessionKey(c))
+	}
+	return key, nil
+}
+
+// bodyTokenExpired reports whether a body token is older than TokenMaxAge,
+// or CookieMaxAge if unset.
+func bodyTokenExpired(cfg Config, token string) bool {
+	maxAge := cfg.CookieMaxAge
+	if cfg.TokenMaxAge > 0 {
+		maxAge = cfg.TokenMaxAge
+	}
+	issued, ok := tokenIssuedAt(token)
+	return !ok || cfg.Now().Sub(issued) > time.Duration(maxAge)*time.Second
+}
+
+// bodySession returns what body tokens are signed for: the session, if
+// any, followed by the fixed-size hex SHA-256 of the body.
+func bodySession(c *fiber.Ctx, cfg Config, body []byte) string {
+	session := ""
+	if cfg.SessionKey != nil {
+		session = cfg.SessionKey(c)
+	}
+	sum := sha256.Sum256(body)
+	return session + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,76 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// validation is a cached result of ValidatorWithSubject.
+type validation struct {
+	token   string
+	subject string
+	ok      bool
+	exp     time.Time
+}
+
+// validatorCache is a size-bounded LRU cache of validations keyed by token.
+type validatorCache struct {
+	mu    sync.Mutex
+	size  int
+	ttl   time.Duration
+	now   func() time.Time
+	order *list.List
+	items map[string]*list.Element
+}
+
+func newValidatorCache(size int, ttl time.Duration, now func() time.Time) *validatorCache {
+	return &validatorCache{
+		size:  size,
+		ttl:   ttl,
+		now:   now,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached validation of token, if it hasn't expired.
+func (vc *validatorCache) get(token string) (validation, bool) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	e, ok := vc.items[token]
+	if !ok {
+		return validation{}, false
+	}
+	v := e.Value.(validation)
+	if vc.now().After(v.exp) {
+		vc.order.Remove(e)
+		delete(vc.items, token)
+		return validation{}, false
+	}
+	vc.order.MoveToFront(e)
+	return v, true
+}
+
+// add caches the validation of token, evicting the least recently used
+// entry if the cache is full.
+func (vc *validatorCache) add(token, subject string, ok bool) {
+	v := validation{token: token, subject: subject, ok: ok, exp: vc.now().Add(vc.ttl)}
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if e, found := vc.items[token]; found {
+		e.Value = v
+		vc.order.MoveToFront(e)
+		return
+	}
+	vc.items[token] = vc.order.PushFront(v)
+	if vc.order.Len() > vc.size {
+		oldest := vc.order.Back()
+		vc.order.Remove(oldest)
+		delete(vc.items, oldest.Value.(validation).token)
+	}
+}
@@ -0,0 +1,35 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_ValidatorCache
+func Test_ValidatorCache(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	vc := newValidatorCache(2, time.Minute, func() time.Time { return now })
+
+	vc.add("a", "alice", true)
+	vc.add("b", "", false)
+	_, ok := vc.get("a")
+	utils.AssertEqual(t, true, ok)
+
+	// "b" is the least recently used
+	vc.add("c", "carol", true)
+	_, ok = vc.get("b")
+	utils.AssertEqual(t, false, ok)
+	v, ok := vc.get("a")
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, "alice", v.subject)
+
+	now = now.Add(time.Minute + time.Second)
+	_, ok = vc.get("c")
+	utils.AssertEqual(t, false, ok)
+}
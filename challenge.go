@@ -0,0 +1,90 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// ChallengeHandler issues a single-use challenge token for the action given
+// in the "action" query parameter. The token expires after ChallengeTTL and
+// is bound to the session when SessionKey is set. Clients send it back in
+// ChallengeLookup to a route protected by RequireChallenge.
+func ChallengeHandler(config Config) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	if cfg.Storage == nil {
+		panic("csrf: ChallengeHandler requires Storage")
+	}
+	return func(c *fiber.Ctx) {
+		action := c.Query("action")
+		if action == "" {
+			c.SendStatus(fiber.StatusBadRequest)
+			return
+		}
+		token, err := generate(cfg)
+		if err != nil {
+			sendTokenError(c, cfg, err)
+			return
+		}
+		if err := cfg.Storage.Set(scopedKey(challengeSession(c, cfg), action, token), []byte{1}, cfg.ChallengeTTL); err != nil {
+			c.SendStatus(fiber.StatusInternalServerError)
+			return
+		}
+		_ = c.JSON(fiber.Map{
+			"token":      token,
+			"action":     action,
+			"expires_in": int(cfg.ChallengeTTL.Seconds()),
+		})
+	}
+}
+
+// RequireChallenge returns a handler that only lets a request through if it
+// carries an unused challenge token issued for action. The token is consumed.
+func RequireChallenge(config Config, action string) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	if cfg.Storage == nil {
+		panic("csrf: RequireChallenge requires Storage")
+	}
+	extractor := newExtractor(cfg.ChallengeLookup, false, 0, cfg.DuplicateTokenFields)
+	return func(c *fiber.Ctx) {
+		token, err := extractor(c)
+		if err != nil {
+			c.SendStatus(fiber.StatusBadRequest)
+			return
+		}
+		ok, err := consumeChallenge(cfg, challengeSession(c, cfg), action, token)
+		if err != nil {
+			c.SendStatus(fiber.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		c.Next()
+	}
+}
+
+// challengeSession returns the hashed session a challenge is bound to.
+func challengeSession(c *fiber.Ctx, cfg Config) string {
+	if cfg.SessionKey == nil {
+		return ""
+	}
+	return cfg.StorageKeyHash(cfg.SessionKey(c))
+}
+
+// consumeChallenge validates and deletes a challenge token, atomically if
+// Storage implements ScopedStorage.
+func consumeChallenge(cfg Config, session, action, token string) (bool, error) {
+	if s, ok := cfg.Storage.(ScopedStorage); ok {
+		return s.ValidateScopedAndConsume(session, action, token)
+	}
+	key := scopedKey(session, action, token)
+	val, err := cfg.Storage.Get(key)
+	if err != nil || val == nil {
+		return false, err
+	}
+	return true, cfg.Storage.Delete(key)
+}
@@ -0,0 +1,72 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// Locals keys owned by the package. Fiber only takes string keys, so they
+// are namespaced by the import path.
+const (
+	// tokenKey holds the token besides ContextKey.
+	tokenKey = "github.com/gofiber/csrf.token"
+	// stateKey holds the State of the request.
+	stateKey = "github.com/gofiber/csrf.state"
+	// sourceKey holds the TokenLookup source the request token came from.
+	sourceKey = "github.com/gofiber/csrf.source"
+	// guardKey holds the tokens of the request that logEvent must not log.
+	guardKey = "github.com/gofiber/csrf.guard"
+	// correlationKey holds the CorrelationID of the request.
+	correlationKey = "github.com/gofiber/csrf.correlation"
+)
+
+// State describes the CSRF state of a request for middlewares that need
+// more than the token.
+type State struct {
+	// Token is the token of the request, as stored under ContextKey.
+	Token string
+	// Source is the TokenLookup source the request token was read from,
+	// e.g. "header:X-CSRF-Token", or "" if none was read.
+	Source string
+	// IssuedAt is when Token was minted, or the zero time for tokens that
+	// don't carry a signed timestamp.
+	IssuedAt time.Time
+	// Validated reports whether the request carried a valid token.
+	Validated bool
+	// Reason is the SkipReason of the request.
+	Reason string
+	// CorrelationID is the id CorrelationID gave the request, if set.
+	CorrelationID string
+}
+
+// StateFromContext returns the State the middleware stored for the request.
+func StateFromContext(c *fiber.Ctx) (State, bool) {
+	state, ok := c.Locals(stateKey).(State)
+	return state, ok
+}
+
+// FromContext returns the token of the request, whatever ContextKey the
+// middleware was configured with, so that packages rendering forms don't
+// need to know the config.
+func FromContext(c *fiber.Ctx) (string, bool) {
+	token, ok := c.Locals(tokenKey).(string)
+	return token, ok && token != ""
+}
+
+// storeToken stores token under ContextKey and the package's own key, and
+// the State of the request.
+func storeToken(c *fiber.Ctx, cfg Config, token string) {
+	c.Locals(cfg.ContextKey, token)
+	c.Locals(tokenKey, token)
+	state := State{Token: token, Reason: SkipReason(c)}
+	state.Source, _ = c.Locals(sourceKey).(string)
+	state.IssuedAt, _ = tokenIssuedAt(token)
+	state.Validated = state.Reason == ReasonValidated
+	state.CorrelationID, _ = c.Locals(correlationKey).(string)
+	c.Locals(stateKey, state)
+}
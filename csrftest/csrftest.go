@@ -0,0 +1,81 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+// Package csrftest provides helpers for testing applications that use the
+// csrf middleware. Nothing in this package is safe for production use.
+package csrftest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+
+	"github.com/gofiber/csrf"
+	"github.com/gofiber/fiber"
+)
+
+// NewDeterministicReader returns a reader that yields the same byte sequence
+// for the same seed. Pass it as csrf.Config.RandReader to make generated
+// tokens reproducible across test runs. It is safe for concurrent use, e.g.
+// by parallel tests sharing a middleware; reads are then interleaved in no
+// particular order.
+func NewDeterministicReader(seed int64) io.Reader {
+	return &lockedReader{r: rand.New(rand.NewSource(seed))} // #nosec G404
+}
+
+// lockedReader serializes reads of a math/rand source, which isn't safe for
+// concurrent use.
+type lockedReader struct {
+	mu sync.Mutex
+	r  io.Reader
+}
+
+func (l *lockedReader) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.r.Read(p)
+}
+
+// Token issues a CSRF cookie and the matching request token for cfg by
+// running a GET through the middleware. Attach both to a request built with
+// httptest.NewRequest to exercise protected endpoints; send the token in the
+// header, form field or query configured in cfg.TokenLookup.
+func Token(cfg csrf.Config) (*http.Cookie, string, error) {
+	name := cfg.CookieName
+	if name == "" {
+		name = "_csrf"
+	}
+	cfg.Filter = nil
+	cfg.RequireSecure = false
+	cfg.ContextKey = "csrftest"
+
+	app := fiber.New()
+	app.Get("/", csrf.New(cfg), func(c *fiber.Ctx) {
+		token, _ := c.Locals(cfg.ContextKey).(string)
+		c.Send(token)
+	})
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("csrftest: middleware responded %d", resp.StatusCode)
+	}
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == name {
+			return &http.Cookie{Name: cookie.Name, Value: cookie.Value}, string(token), nil
+		}
+	}
+	return nil, "", errors.New("csrftest: middleware did not set the CSRF cookie")
+}
@@ -0,0 +1,98 @@
+package csrftest_test
+
+import (
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gofiber/csrf"
+	"github.com/gofiber/csrf/csrftest"
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/utils"
+)
+
+func tokens(t *testing.T, seed int64, n int) []string {
+	app := fiber.New()
+	app.Use(csrf.New(csrf.Config{RandReader: csrftest.NewDeterministicReader(seed)}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	var out []string
+	for i := 0; i < n; i++ {
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		cookies := resp.Cookies()
+		utils.AssertEqual(t, 1, len(cookies))
+		out = append(out, cookies[0].Value)
+	}
+	return out
+}
+
+// go test -run Test_DeterministicReader
+func Test_DeterministicReader(t *testing.T) {
+	a := tokens(t, 42, 3)
+	b := tokens(t, 42, 3)
+	utils.AssertEqual(t, a, b)
+	utils.AssertEqual(t, true, a[0] != a[1])
+	utils.AssertEqual(t, 36, len(a[0]))
+
+	c := tokens(t, 7, 3)
+	utils.AssertEqual(t, true, a[0] != c[0])
+}
+
+// go test -run Test_DeterministicReader_Concurrent
+func Test_DeterministicReader_Concurrent(t *testing.T) {
+	r := csrftest.NewDeterministicReader(42)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, 16)
+			for j := 0; j < 100; j++ {
+				_, _ = r.Read(buf)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// go test -run Test_Token
+func Test_Token(t *testing.T) {
+	cfg := csrf.Config{CookieName: "_csrf_app", TokenLookup: "header:X-XSRF-Token"}
+	app := fiber.New()
+	app.Use(csrf.New(cfg))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	cookie, token, err := csrftest.Token(cfg)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "_csrf_app", cookie.Name)
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("X-XSRF-Token", token)
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-XSRF-Token", token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+
+	// Split-token mode hands out a token that differs from the cookie
+	cfg = csrf.Config{Mode: csrf.ModeSplitToken}
+	app = fiber.New()
+	app.Use(csrf.New(cfg))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	cookie, token, err = csrftest.Token(cfg)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, cookie.Value != token)
+	req = httptest.NewRequest("POST", "/", nil)
+	req.AddCookie(cookie)
+	req.Header.Set("X-CSRF-Token", token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+}
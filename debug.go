@@ -0,0 +1,106 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// debugTimer records how long the stages of a request take when Debug is
+// set. Its methods do nothing on a nil timer, so timing costs nothing
+// otherwise.
+type debugTimer struct {
+	fields map[string]interface{}
+	start  time.Time
+}
+
+// newDebugTimer returns a timer for the request, or nil unless Debug is set.
+func newDebugTimer(cfg Config, c *fiber.Ctx) *debugTimer {
+	if !cfg.Debug {
+		return nil
+	}
+	return &debugTimer{fields: map[string]interface{}{"path": logPath(c, cfg)}}
+}
+
+// begin starts timing a stage.
+func (t *debugTimer) begin() {
+	if t != nil {
+		t.start = time.Now()
+	}
+}
+
+// end records the time since begin as stage.
+func (t *debugTimer) end(stage string) {
+	if t != nil {
+		t.fields[stage] = time.Since(t.start)
+	}
+}
+
+// report logs the recorded stages of a request that was validated, so that
+// safe requests, which only touch storage, don't add a log line each.
+func (t *debugTimer) report(c *fiber.Ctx, cfg Config) {
+	if _, ok := t.fields["extract"]; ok {
+		logEvent(c, cfg, "timing", t.fields)
+	}
+}
+
+// logPath returns the request path for log events, redacted if a param
+// source of TokenLookup may have put the token in it.
+func logPath(c *fiber.Ctx, cfg Config) string {
+	if strings.Contains(cfg.TokenLookup, "param:") {
+		return "(redacted)"
+	}
+	return c.Path()
+}
+
+// guardTokens marks tokens of the request that must never reach the Logger.
+// Only mark tokens the middleware minted or read from Storage: a token
+// chosen by the client, e.g. "POST", would match ordinary fields. It does
+// nothing unless Debug is set.
+func guardTokens(c *fiber.Ctx, cfg Config, tokens ...string) {
+	if !cfg.Debug {
+		return
+	}
+	guarded, _ := c.Locals(guardKey).([]string)
+	for _, token := range tokens {
+		if token != "" {
+			guarded = append(guarded, token)
+		}
+	}
+	c.Locals(guardKey, guarded)
+}
+
+// panicOnLeak makes logEvent panic on guarded fields instead of redacting
+// them. Only the package's tests set it: fields are derived from the
+// request, and a panic there would let any client crash the server.
+var panicOnLeak = false
+
+// logEvent passes an event of the request to the Logger. With Debug set it
+// redacts fields that are a token marked by guardTokens.
+func logEvent(c *fiber.Ctx, cfg Config, msg string, fields map[string]interface{}) {
+	if cfg.Debug {
+		guarded, _ := c.Locals(guardKey).([]string)
+		for key, value := range fields {
+			s := fmt.Sprint(value)
+			for _, token := range guarded {
+				if s != token {
+					continue
+				}
+				if panicOnLeak {
+					panic("csrf: log field " + key + " contains a token")
+				}
+				fields[key] = "(redacted)"
+			}
+		}
+	}
+	if id, ok := c.Locals(correlationKey).(string); ok {
+		fields["correlation_id"] = id
+	}
+	cfg.Logger(msg, fields)
+}
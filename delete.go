@@ -0,0 +1,49 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// Delete clears the CSRF state of the request, e.g. on logout: it expires
+// the CSRF cookies and, in ModeSynchronizer, removes the session's tokens
+// from Storage. With ClearSiteDataOnDelete, the response also asks the
+// browser to purge all cookies of the site.
+func Delete(c *fiber.Ctx, config Config) error {
+	cfg := configDefault(config)
+	if cfg.Mode == ModeSynchronizer {
+		if err := cfg.Storage.Delete(storageKey(cfg, cfg.SessionKey(c))); err != nil {
+			return err
+		}
+	}
+	if !cfg.CookieDisabled {
+		expireCookie(c, cfg, cfg.CookieName, cfg.CookiePath, cfg.CookieDomain, cfg.CookieSameSite)
+		if cfg.Mode == ModeSplitToken {
+			expireCookie(c, cfg, cfg.TokenCookieName, cfg.TokenCookiePath, cfg.TokenCookieDomain, cfg.TokenCookieSameSite)
+		}
+	}
+	c.Locals(cfg.ContextKey, nil)
+	c.Locals(tokenKey, nil)
+	c.Locals(stateKey, nil)
+	if cfg.ClearSiteDataOnDelete {
+		c.Set("Clear-Site-Data", `"cookies"`)
+	}
+	return nil
+}
+
+// expireCookie tells the browser to drop a cookie set by setCookie.
+func expireCookie(c *fiber.Ctx, cfg Config, name, path, domain, sameSite string) {
+	sendCookie(c, cfg, &fiber.Cookie{
+		Name:     name,
+		Path:     path,
+		Domain:   domain,
+		Expires:  time.Unix(1, 0),
+		Secure:   cfg.CookieSecure || cfg.RequireSecure,
+		SameSite: sameSite,
+	})
+}
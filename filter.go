@@ -0,0 +1,38 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+// IssuedFilter is a probabilistic set of issued tokens, e.g. a bloom filter
+// shared by the instances of a cluster, that lets the middleware reject
+// tokens it never issued before the full check.
+type IssuedFilter interface {
+	// Add records a token the middleware issued.
+	Add(token string) error
+	// MayContain reports false only if token was never added. False
+	// positives are fine, the token still goes through full validation.
+	MayContain(token string) (bool, error)
+}
+
+// addIssued records token in IssuedFilter, if set.
+func addIssued(cfg Config, token string) error {
+	if cfg.IssuedFilter == nil {
+		return nil
+	}
+	return cfg.IssuedFilter.Add(token)
+}
+
+// neverIssued reports whether IssuedFilter knows that clientToken was never
+// issued. Tokens the middleware doesn't issue itself, such as those of
+// ExpectedToken, EdgeTokenHeader or ValidatorWithSubject, must skip it.
+func neverIssued(cfg Config, clientToken string) (bool, error) {
+	if cfg.IssuedFilter == nil {
+		return false, nil
+	}
+	if testToken != "" && clientToken == testToken {
+		return false, nil
+	}
+	ok, err := cfg.IssuedFilter.MayContain(clientToken)
+	return !ok, err
+}
@@ -0,0 +1,75 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/utils"
+)
+
+// setFilter is an exact IssuedFilter, or one that may contain everything if
+// all is set, to simulate false positives.
+type setFilter struct {
+	tokens map[string]bool
+	all    bool
+}
+
+func (f *setFilter) Add(token string) error {
+	f.tokens[token] = true
+	return nil
+}
+
+func (f *setFilter) MayContain(token string) (bool, error) {
+	return f.all || f.tokens[token], nil
+}
+
+// go test -run Test_IssuedFilter
+func Test_IssuedFilter(t *testing.T) {
+	filter := &setFilter{tokens: map[string]bool{}}
+	var validations []Validation
+	app := fiber.New()
+	app.Use(New(Config{
+		IssuedFilter: filter,
+		OnValidate: func(c *fiber.Ctx, v Validation) {
+			validations = append(validations, v)
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+	utils.AssertEqual(t, true, filter.tokens[token])
+
+	post := func(token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post(token))
+	utils.AssertEqual(t, true, validations[0].Valid)
+
+	// A forged cookie and header pair would pass a plain double submit check
+	utils.AssertEqual(t, fiber.StatusForbidden, post("forged"))
+	utils.AssertEqual(t, ErrTokenNotIssued, validations[1].Err)
+
+	// False positives fall through to full validation
+	filter.all = true
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-CSRF-Token", "forged")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, false, validations[2].Valid)
+	utils.AssertEqual(t, nil, validations[2].Err)
+}
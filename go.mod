@@ -5,4 +5,5 @@ go 1.11
 require (
 	github.com/gofiber/fiber v1.14.2
 	github.com/gofiber/utils v0.0.9
+	github.com/valyala/fasthttp v1.15.1
 )
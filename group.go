@@ -0,0 +1,21 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// Group returns the middleware for a group of routes whose tokens must not
+// be shared with other groups, e.g. app.Group("/admin", csrf.Group("admin",
+// cfg)). The cookie names and ContextKey of base, or their defaults, are
+// suffixed with "_" + name, so "_csrf" becomes "_csrf_admin".
+func Group(name string, base Config) func(*fiber.Ctx) {
+	cfg := configDefault(base)
+	cfg.CookieName += "_" + name
+	cfg.TokenCookieName += "_" + name
+	cfg.ContextKey += "_" + name
+	return New(cfg)
+}
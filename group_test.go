@@ -0,0 +1,53 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_Group
+func Test_Group(t *testing.T) {
+	app := fiber.New()
+	for _, name := range []string{"admin", "shop"} {
+		key := "csrf_" + name
+		group := app.Group("/"+name, Group(name, Config{}))
+		group.Get("/", func(c *fiber.Ctx) {
+			c.Send(c.Locals(key))
+		})
+		group.Post("/", func(c *fiber.Ctx) {})
+	}
+
+	tokens := map[string]string{}
+	for _, name := range []string{"admin", "shop"} {
+		resp, err := app.Test(httptest.NewRequest("GET", "/"+name+"/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, 1, len(resp.Cookies()))
+		utils.AssertEqual(t, "_csrf_"+name, resp.Cookies()[0].Name)
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, resp.Cookies()[0].Value, string(body))
+		tokens[name] = string(body)
+	}
+	utils.AssertEqual(t, true, tokens["admin"] != tokens["shop"])
+
+	post := func(path, cookie, token string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set(fiber.HeaderCookie, cookie)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post("/admin/", "_csrf_admin="+tokens["admin"], tokens["admin"]))
+	// The shop cookie and token don't unlock admin routes
+	utils.AssertEqual(t, fiber.StatusForbidden, post("/admin/", "_csrf_shop="+tokens["shop"], tokens["shop"]))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("/shop/", "_csrf_admin="+tokens["admin"], tokens["admin"]))
+}
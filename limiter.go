@@ -0,0 +1,49 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"fmt"
+	"time"
+)
+
+// limiter counts events per key in fixed windows kept in Storage. Counting
+// is not atomic across instances, so limits are approximate.
+type limiter struct {
+	storage Storage
+	prefix  string
+	limit   int
+	window  time.Duration
+	now     func() time.Time
+}
+
+// allow records an event for key and reports whether it is within the limit.
+// If not, it also returns the time until the window resets.
+func (l *limiter) allow(key string) (bool, time.Duration, error) {
+	key = l.prefix + key
+	now := l.now()
+	count, start := 0, now.UnixNano()
+	val, err := l.storage.Get(key)
+	if err != nil {
+		return false, 0, err
+	}
+	if val != nil {
+		if _, err := fmt.Sscanf(string(val), "%d %d", &count, &start); err != nil {
+			count, start = 0, now.UnixNano()
+		}
+	}
+	reset := time.Unix(0, start).Add(l.window).Sub(now)
+	if reset <= 0 {
+		count, start, reset = 0, now.UnixNano(), l.window
+	}
+	if count >= l.limit {
+		return false, reset, nil
+	}
+	count++
+	if err := l.storage.Set(key, []byte(fmt.Sprintf("%d %d", count, start)), reset); err != nil {
+		return false, 0, err
+	}
+	return true, reset, nil
+}
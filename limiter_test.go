@@ -0,0 +1,35 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_Limiter
+func Test_Limiter(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	l := &limiter{storage: NewMemoryStorage(), limit: 1, window: time.Minute, now: func() time.Time { return now }}
+
+	ok, _, err := l.allow("a")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, ok)
+
+	now = now.Add(20 * time.Second)
+	ok, reset, err := l.allow("a")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, false, ok)
+	utils.AssertEqual(t, 40*time.Second, reset)
+
+	ok, _, _ = l.allow("b")
+	utils.AssertEqual(t, true, ok)
+
+	now = now.Add(40 * time.Second)
+	ok, _, _ = l.allow("a")
+	utils.AssertEqual(t, true, ok)
+}
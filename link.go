@@ -0,0 +1,75 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// SignLink returns path with a fresh token, an expiry and a signature over
+// the three appended as the "csrf", "exp" and "sig" query parameters, for
+// one-click actions in emails. path must not contain a query. Validate the
+// link with RequireSignedLink. Requires Secret.
+func SignLink(config Config, path string, ttl time.Duration) (string, error) {
+	cfg := configDefault(config)
+	if len(cfg.Secret) == 0 {
+		return "", errors.New("csrf: SignLink requires Secret")
+	}
+	token, err := generate(cfg)
+	if err != nil {
+		return "", err
+	}
+	exp := strconv.FormatInt(cfg.Now().Add(ttl).Unix(), 10)
+	q := url.Values{}
+	q.Set("csrf", token)
+	q.Set("exp", exp)
+	q.Set("sig", base64.RawURLEncoding.EncodeToString(linkMAC(cfg.Secret, path, token, exp)))
+	return path + "?" + q.Encode(), nil
+}
+
+// RequireSignedLink returns a handler that only lets a request through if its
+// path and query were produced by SignLink and have not expired. Keep the
+// query in the action of a confirmation form so that a GET-then-POST flow
+// validates twice.
+func RequireSignedLink(config Config) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	if len(cfg.Secret) == 0 {
+		panic("csrf: RequireSignedLink requires Secret")
+	}
+	return func(c *fiber.Ctx) {
+		token, exp, sig := c.Query("csrf"), c.Query("exp"), c.Query("sig")
+		if token == "" || exp == "" || sig == "" {
+			c.SendStatus(fiber.StatusBadRequest)
+			return
+		}
+		mac, err := base64.RawURLEncoding.DecodeString(sig)
+		if err != nil || !hmac.Equal(mac, linkMAC(cfg.Secret, c.Path(), token, exp)) {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		expires, err := strconv.ParseInt(exp, 10, 64)
+		if err != nil || cfg.Now().Unix() > expires {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		storeToken(c, cfg, token)
+		c.Next()
+	}
+}
+
+// linkMAC computes the signature of a link.
+func linkMAC(secret []byte, path, token, exp string) []byte {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte(path + "\n" + token + "\n" + exp))
+	return h.Sum(nil)
+}
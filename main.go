@@ -6,146 +6,2206 @@
 package csrf
 
 import (
+	"bytes"
+	"crypto/rand"
 	"crypto/subtle"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber"
-	"github.com/gofiber/utils"
 )
 
+// Mode selects how tokens are issued and validated.
+type Mode int
+
+const (
+	// ModeDoubleSubmit compares the request token with the CSRF cookie.
+	ModeDoubleSubmit Mode = iota
+	// ModeHMAC issues tokens of the form HMAC(Secret, session || random)
+	// and validates them by recomputing the HMAC for the session returned
+	// by SessionKey. No token state is kept on the server.
+	ModeHMAC
+	// ModeSplitToken stores a random secret in the CSRF cookie, which should
+	// be HTTP only, and hands clients a token derived from it through a
+	// second, readable cookie named TokenCookieName.
+	ModeSplitToken
+	// ModeSynchronizer keeps one token per session, as returned by
+	// SessionKey, in Storage and compares the request token with it.
+	ModeSynchronizer
+	// ModeSaltedHMAC issues a fresh token of the form
+	// salt || HMAC(Secret, session || salt) on every request and validates
+	// it by recomputing the HMAC with the given salt for the session
+	// returned by SessionKey. Tokens differ per request but all of them stay
+	// valid for the session, and no CSRF cookie is written.
+	ModeSaltedHMAC
+)
+
+// MismatchPolicy decides which token wins when Storage and the CSRF cookie
+// disagree in ModeSynchronizer.
+type MismatchPolicy int
+
+const (
+	// TrustStorage uses the stored token and logs the mismatch.
+	TrustStorage MismatchPolicy = iota
+	// TrustCookie uses the cookie token and overwrites the stored one.
+	TrustCookie
+	// RejectMismatch rejects the request with 403 Forbidden.
+	RejectMismatch
+)
+
+// DuplicatePolicy decides which value a form source yields when a body holds
+// the token field more than once.
+type DuplicatePolicy int
+
+const (
+	// FirstValue uses the first value, like Ctx.FormValue.
+	FirstValue DuplicatePolicy = iota
+	// LastValue uses the last value.
+	LastValue
+	// RejectDuplicates rejects the request with 403 Forbidden.
+	RejectDuplicates
+)
+
+// ErrStorageCookieMismatch is returned when Storage and the CSRF cookie hold
+// different tokens under RejectMismatch.
+var ErrStorageCookieMismatch = errors.New("csrf: storage and cookie tokens differ")
+
+// ErrSourcesDisagree is returned when the sources of a RequireAllSources
+// lookup yield different tokens.
+var ErrSourcesDisagree = errors.New("csrf: token sources disagree")
+
+// ErrDuplicateToken is returned when a form holds the token field more than
+// once under RejectDuplicates.
+var ErrDuplicateToken = errors.New("csrf: token field repeated")
+
+// ErrCookieRequired is reported through OnValidate when a request carries a
+// token but no CSRF cookie to check it against, e.g. because the browser
+// blocks cookies.
+var ErrCookieRequired = errors.New("csrf: token present but cookie missing")
+
+// ErrTokenBlocked is reported through OnValidate when Blocklist rejects a
+// token.
+var ErrTokenBlocked = errors.New("csrf: token is blocklisted")
+
+// ErrTokenMalformed is reported through OnValidate when a token of a signed
+// mode doesn't have the structure of a signed token, e.g. because it was
+// truncated or isn't base64.
+var ErrTokenMalformed = errors.New("csrf: token is malformed")
+
+// ErrBadSignature is reported through OnValidate when a well-formed token of
+// a signed mode doesn't verify, e.g. because it was signed for another
+// session or with another key.
+var ErrBadSignature = errors.New("csrf: token signature is invalid")
+
+// ErrMethodNotAllowed is reported through OnValidate when a token with a
+// valid signature is used with a method AllowedMethods didn't embed in it.
+var ErrMethodNotAllowed = errors.New("csrf: token not allowed for this method")
+
+// ErrTokenExpired is reported through OnValidate when a token with a valid
+// signature is older than TokenMaxAge.
+var ErrTokenExpired = errors.New("csrf: token expired")
+
+// ErrTokenLength is reported through OnValidate when EnforceTokenLength
+// rejects a token of unexpected length.
+var ErrTokenLength = errors.New("csrf: token has unexpected length")
+
+// ErrTokenNotIssued is reported through OnValidate when IssuedFilter knows
+// that a token was never issued.
+var ErrTokenNotIssued = errors.New("csrf: token was never issued")
+
+// ErrTokenRevoked is reported through OnValidate when
+// ValidateSafeAgainstStorage finds the cookie token of a safe request
+// missing from Storage.
+var ErrTokenRevoked = errors.New("csrf: token is no longer stored")
+
+// errEmptyToken is the generation error of a Generator that returned no token.
+var errEmptyToken = errors.New("csrf: generator returned an empty token")
+
+// generateError wraps errors of Generator and RandReader, so that they are
+// answered with GeneratorErrorStatus rather than a guessable token.
+type generateError struct {
+	err error
+}
+
+func (e generateError) Error() string {
+	return e.err.Error()
+}
+
+// Validation describes the outcome of validating a request token.
+type Validation struct {
+	// Valid reports whether the token was accepted.
+	Valid bool
+
+	// Age is the time since the token was issued. It is only set when
+	// HasAge is true, i.e. for valid tokens that carry a signed timestamp.
+	Age    time.Duration
+	HasAge bool
+
+	// Err tells why the token was rejected, when a specific cause is known.
+	Err error
+
+	// CorrelationID is the id CorrelationID gave the request, if set.
+	CorrelationID string
+}
+
 // Config ...
 type Config struct {
 	// Filter defines a function to skip middleware.
 	// Optional. Default: nil
 	Filter func(*fiber.Ctx) bool
 
-	// TokenLength is the length of the generated token.
-	TokenLength uint8
-	// Optional. Default value 32.
+	// ExemptPaths lists request paths which skip the middleware entirely,
+	// e.g. webhooks authenticated by other means.
+	// Optional. Default value nil.
+	ExemptPaths []string
+
+	// StrictPaths matches ExemptPaths and CacheablePaths exactly. By default
+	// a trailing slash is ignored, so "/webhook" also covers "/webhook/",
+	// like Fiber's routing unless StrictRouting is enabled.
+	// Optional. Default value false.
+	StrictPaths bool
+
+	// TokenLength is the length of the generated token.
+	// Optional. Default value 32.
+	TokenLength uint8
+
+	// EnforceTokenLength rejects request tokens whose length differs from
+	// TokenLength before comparing them, as a cheap guard against probing.
+	// The length of fixed-size tokens isn't secret, so this leaks nothing;
+	// tokens of the right length still go through the constant-time compare.
+	// With the default UUIDGenerator, TokenLength defaults to its 36
+	// characters; a custom Generator must produce TokenLength characters.
+	// Requires ModeDoubleSubmit or ModeSynchronizer, or ValidatorWithSubject
+	// for tokens of TokenLength issued elsewhere.
+	// Optional. Default value false.
+	EnforceTokenLength bool
+
+	// TokenEncoding is the encoding of the tokens Generator produces,
+	// "hex" or "base64". With it, ModeDoubleSubmit and ModeSynchronizer
+	// compare decoded bytes rather than strings, so a client echoing the
+	// token re-encoded in hex or base64, with either alphabet and with or
+	// without padding, still validates. Tokens that decode to a different
+	// length never match. Requires a Generator or Alphabet producing such
+	// tokens, and can't be combined with EnforceTokenLength or HashVerify,
+	// which work on the encoded token.
+	// Optional. Default value "" (compare the tokens as strings).
+	TokenEncoding string
+
+	// TokenLookup is a string in the form of "<source>:<key>" that is used
+	// to extract token from the request. Separate several lookups with
+	// commas, e.g. "header:X-CSRF-Token,form:_csrf", to try them in order;
+	// sources that parse the body (form and multipart) are tried after all
+	// others, so a token in a header or the query spares the parsing.
+	// Optional. Default value "header:X-CSRF-Token".
+	// Possible values:
+	// - "header:<name>"
+	// - "form:<name>", read once the whole body, chunked or not, has arrived
+	// - "multipart:<name>", the first part of a multipart body, which must
+	//   be the named field; later parts such as uploads aren't read
+	// - "query:<name>"
+	// - "param:<name>"
+	// - "forwarded:<name>", a parameter of the RFC7239 Forwarded header
+	// - "headerfield:<header>:<field>", a field of a structured header value
+	//   such as "X-Security: nonce=abc;csrf=xyz"
+	TokenLookup string
+
+	// RequireAllSources only accepts a request if every lookup in a multi
+	// source TokenLookup yields the same token; a missing source rejects it.
+	// Optional. Default value false.
+	RequireAllSources bool
+
+	// DuplicateTokenFields decides how form sources treat a token field that
+	// appears more than once in the body, e.g. because an attacker slipped
+	// in a second one.
+	// Optional. Default value FirstValue.
+	DuplicateTokenFields DuplicatePolicy
+
+	// MaxSourceAttempts bounds how many TokenLookup sources are tried per
+	// request, so that a long lookup list can't be used to force costly
+	// extraction. Must cover every source if RequireAllSources is set.
+	// Optional. Default value 0 (no limit).
+	MaxSourceAttempts int
+
+	// MissingTokenHandlers maps TokenLookup sources, e.g. "form:_csrf", to
+	// the handler that responds when a request carries no token, instead of
+	// the 400 status, e.g. a 401 for API clients or a redirect to a fresh
+	// form for browsers. A form or multipart source answers for requests
+	// whose body has its content type; otherwise the first other source in
+	// TokenLookup with a handler does.
+	// Optional. Default value nil (400 for every source).
+	MissingTokenHandlers map[string]func(*fiber.Ctx)
+
+	// Context key to store generated CSRF token into context.
+	// Optional. Default value "csrf".
+	ContextKey string
+
+	// Name of the CSRF cookie. This cookie will store CSRF token.
+	// Optional. Default value "csrf".
+	CookieName string
+
+	// Domain of the CSRF cookie.
+	// Optional. Default value none.
+	CookieDomain string
+
+	// Path of the CSRF cookie.
+	// Optional. Default value none.
+	CookiePath string
+
+	// Max age (in seconds) of the CSRF cookie.
+	// Optional. Default value 86400 (24hr).
+	CookieMaxAge int
+
+	// Indicates if CSRF cookie is secure.
+	// Optional. Default value false.
+	CookieSecure bool
+
+	// Indicates if CSRF cookie is HTTP only.
+	// Optional. Default value false.
+	CookieHTTPOnly bool
+
+	// SameSite attribute of the CSRF cookies: "Lax", "Strict" or "None".
+	// Optional. Default value "Lax".
+	CookieSameSite string
+
+	// SameSiteFunc decides the SameSite attribute of each cookie the
+	// middleware sets, given the configured one; "" omits the attribute.
+	// LegacySameSite omits None for user agents that mishandle it.
+	// Optional. Default value nil (the configured attribute).
+	SameSiteFunc func(c *fiber.Ctx, sameSite string) string
+
+	// HistorySize is how many of the latest tokens of a session are kept
+	// in ModeSynchronizer and accepted, so that tabs holding a token issued
+	// before a refresh keep working. The oldest token is evicted first.
+	// The history is kept in the session's Storage entry, space separated.
+	// Optional. Default value 0, i.e. only the latest token is accepted.
+	HistorySize int
+
+	// OnStorageCookieMismatch decides what happens when the token in Storage
+	// and the CSRF cookie differ in ModeSynchronizer, which hints at a stale
+	// cookie or an attack.
+	//
+	// The request token is checked against the first expected token found,
+	// in this order: the DebugTokenKey token, the EdgeTokenHeader token, the
+	// ExpectedTokenKey token, then the token in Storage or in the CSRF cookie
+	// as chosen by this policy. Signed modes ignore a cookie signed for
+	// another session and validate the request token for the current one.
+	// Optional. Default value TrustStorage.
+	OnStorageCookieMismatch MismatchPolicy
+
+	// CookieDisabled stops the middleware from setting the CSRF cookie, for
+	// server-rendered apps using ModeSynchronizer that embed the token from
+	// the context in their forms. ModeSplitToken, and ModeDoubleSubmit
+	// unless ExpectedTokenKey, EdgeTokenHeader or ValidatorWithSubject
+	// supply the expected token, can't validate without the cookie and
+	// panic with it.
+	// Optional. Default value false.
+	CookieDisabled bool
+
+	// VerifyOnly validates tokens issued by another service sharing Secret
+	// or KeyFunc, e.g. in a mesh where one service sets the CSRF cookie and
+	// others only check requests against it. The middleware then never
+	// generates tokens or sets cookies; ContextKey holds the cookie's token
+	// if its signature verifies. Requires ModeHMAC or ModeSaltedHMAC.
+	// Optional. Default value false.
+	VerifyOnly bool
+
+	// RandReader is the source of randomness used to generate tokens.
+	// Inject a deterministic reader to get reproducible tokens in tests,
+	// never do this in production.
+	// Optional. Default value crypto/rand.Reader.
+	RandReader io.Reader
+
+	// Generator generates the tokens of ModeDoubleSubmit and
+	// ModeSynchronizer, the secret of ModeSplitToken, and challenge and link
+	// tokens. Use ULIDGenerator for tokens that sort by issue time.
+	// Optional. Default value UUIDGenerator.
+	Generator Generator
+
+	// Alphabet, if set and Generator is not, generates tokens of TokenLength
+	// characters from it with AlphabetGenerator, e.g. HumanAlphabet for
+	// tokens that users type in. A warning is logged if such tokens carry
+	// less than 64 bits of entropy.
+	// Optional. Default value "".
+	Alphabet string
+
+	// VaryExclude lists header fields the middleware must not add to the
+	// Vary response header, e.g. "Cookie" when a cache in front of the app
+	// already keys on it. Existing Vary values are always preserved.
+	// Optional. Default value nil.
+	VaryExclude []string
+
+	// CacheablePaths lists paths, e.g. of a cached HTML shell, for which the
+	// middleware doesn't add "Vary: Cookie", so that one cached body serves
+	// every visitor. Responses on them get no token, neither in a cookie nor
+	// under ContextKey, since a shared cache would hand it to everyone: let
+	// JavaScript read the CSRF cookie another response set, which must then
+	// not be HTTP only, and send it in the request header.
+	// Optional. Default value nil.
+	CacheablePaths []string
+
+	// EarlyTokenHeader names a response header, e.g. "X-CSRF-Token", that
+	// carries the token on GET and HEAD responses, so that scripts of the
+	// document can read it from the headers without parsing the body. It
+	// is never set on CacheablePaths, and the response otherwise gets
+	// "Vary: Cookie" as usual, so shared caches don't hand it to others.
+	// Optional. Default value "" (disabled).
+	EarlyTokenHeader string
+
+	// EmitProtectionHeader sets ProtectionHeader to "1" on every response
+	// the middleware is engaged on, for security scanners and debugging.
+	// Optional. Default value false.
+	EmitProtectionHeader bool
+
+	// ProtectionHeader is the name of the header set by EmitProtectionHeader.
+	// Optional. Default value "X-CSRF-Protection".
+	ProtectionHeader string
+
+	// Mode selects the token pattern.
+	// Optional. Default value ModeDoubleSubmit.
+	Mode Mode
+
+	// Secret is the key used to sign tokens.
+	// Required for ModeHMAC and ModeSaltedHMAC unless KeyFunc is set.
+	Secret []byte
+
+	// MigratePlainTokens eases switching an app from ModeDoubleSubmit to
+	// ModeHMAC: a CSRF cookie holding an unsigned token is replaced by a
+	// signed one on the next response, and until then unsafe requests are
+	// also accepted if their token equals that cookie. Remove it once the
+	// cookies issued before the switch have expired.
+	// Optional. Default value false.
+	MigratePlainTokens bool
+
+	// DeriveSessionKeys signs the tokens of ModeHMAC and ModeSaltedHMAC
+	// with a key derived per session from Secret, or the key of KeyFunc,
+	// with HKDF-SHA256, so that a leaked session key doesn't expose the
+	// tokens of other sessions. Enabling it invalidates issued tokens.
+	// Optional. Default value false.
+	DeriveSessionKeys bool
+
+	// TimeBucket switches ModeHMAC to stateless time-bucketed tokens,
+	// HMAC(Secret, session || bucket), which change every TimeBucket. Tokens
+	// of the current and the previous bucket validate, so a token lives
+	// between one and two intervals without any rotation logic.
+	// Optional. Default value 0 (random, signed tokens).
+	TimeBucket time.Duration
+
+	// KeyFunc resolves the signing key per request, e.g. the key of a tenant
+	// fetched from a KMS; cache it on your side. If it returns an error the
+	// request is rejected with 503 Service Unavailable. Overrides Secret.
+	// Optional. Default value nil.
+	KeyFunc func(*fiber.Ctx) ([]byte, error)
+
+	// FingerprintHeaders binds signed tokens (ModeHMAC, ModeSaltedHMAC and
+	// ModeSplitToken) to a hash of the values of these request headers,
+	// e.g. "Accept-Language" and "User-Agent", as a lightweight device
+	// fingerprint. Changing the value of any listed header, e.g. through a
+	// browser update, invalidates the tokens issued before.
+	// Optional. Default value nil.
+	FingerprintHeaders []string
+
+	// AllowedMethods returns the methods the tokens issued for a request may
+	// be used with, e.g. only "POST" for a form. They are embedded in signed
+	// tokens (ModeHMAC, ModeSaltedHMAC and ModeSplitToken), and a token used
+	// with another method, including one tunneled through
+	// MethodOverrideHeader, is rejected. ModeHMAC and ModeSplitToken reuse the
+	// token of the cookie, so the methods of its first request stick; use
+	// ModeSaltedHMAC for methods that differ per page.
+	// Optional. Default value nil (any method).
+	AllowedMethods func(*fiber.Ctx) []string
+
+	// SessionKey returns the identifier of the session the request belongs
+	// to, e.g. the value of a session cookie the application already trusts.
+	// Required for ModeHMAC, ModeSaltedHMAC and ModeSynchronizer.
+	SessionKey func(*fiber.Ctx) string
+
+	// Blocklist rejects request tokens known to be compromised, e.g. because
+	// they leaked into logs, with 403 Forbidden even if they would validate.
+	// Rejections are logged without the token.
+	// Optional. Default value nil.
+	Blocklist func(token string) bool
+
+	// IssuedFilter records the tokens the middleware issues and rejects
+	// request tokens it reports as never issued with 403 Forbidden before
+	// the cryptographic check or storage lookup. Tokens it may contain,
+	// including false positives, go through full validation. It isn't
+	// consulted for ExpectedToken, EdgeTokenHeader, DebugTokenKey and
+	// ValidatorWithSubject tokens.
+	// Optional. Default value nil.
+	IssuedFilter IssuedFilter
+
+	// HashVerify compares the request token with an expected token that is
+	// stored hashed, e.g. with bcrypt, in Storage or under ExpectedTokenKey.
+	// It replaces the constant-time comparison in ModeDoubleSubmit, where it
+	// requires ExpectedTokenKey, and ModeSynchronizer, where it requires
+	// HashToken. Slow hashes run once per validated request, and once per
+	// entry with HistorySize, so they cost far more than a comparison.
+	// Optional. Default value nil (plain constant-time comparison).
+	HashVerify func(hashed, client string) bool
+
+	// HashToken hashes the tokens ModeSynchronizer keeps in Storage, for
+	// HashVerify to check. Clients keep getting the plaintext token, through
+	// the cookie and ContextKey. Since the plaintext can't be read back from
+	// Storage, a request whose cookie doesn't verify, e.g. any safe request
+	// with CookieDisabled, is handed a fresh token; keep HistorySize above 1
+	// so that earlier ones stay valid. It can't be combined with TrustCookie.
+	// Optional. Default value nil.
+	HashToken func(token string) string
+
+	// Debug enables diagnostics that are too noisy or costly for production,
+	// such as warning when ContextKey is already in use by another middleware
+	// and logging the time spent loading the stored token ("storage"),
+	// extracting the request token ("extract") and comparing them
+	// ("compare") of validated requests, e.g. to find a slow Storage backend,
+	// and logging rejected tokens with their path, method, source and
+	// reason. Debug also redacts log fields that are a token the middleware
+	// minted or read from Storage for the request; the package's own tests
+	// panic instead, to catch leaks.
+	// Optional. Default value false.
+	Debug bool
+
+	// EdgeTokenHeader names a header through which an edge worker in front
+	// of the app, e.g. on a CDN, hands out the token of the request, signed
+	// with SignEdgeToken and EdgeSecret. A validly signed header takes the
+	// place of the issued token, so it is set as cookie and validated like
+	// one; a header with a bad signature rejects the request. Only used in
+	// ModeDoubleSubmit. Make sure clients can't reach the app without
+	// passing the edge, which must strip the header from client requests.
+	// Optional. Default value "" (disabled).
+	EdgeTokenHeader string
+
+	// EdgeSecret is the key edge tokens are signed with.
+	// Required with EdgeTokenHeader.
+	EdgeSecret []byte
+
+	// ExpectedTokenKey is a context key under which an upstream middleware,
+	// e.g. one decoding the session, may store the expected token. When set
+	// for a request, the request token is validated against it and the
+	// cookie is ignored. Only used in ModeDoubleSubmit and ModeSynchronizer.
+	// Optional. Default value "" (disabled).
+	ExpectedTokenKey string
+
+	// DebugTokenKey is the context key a debug middleware can set to force
+	// the token of a request, e.g. to replay a reported bug. It is ignored
+	// unless Debug is set, and only used in ModeDoubleSubmit and
+	// ModeSynchronizer.
+	// Optional. Default value "csrf_debug_token".
+	DebugTokenKey string
+
+	// Logger receives diagnostic events. Fields never hold raw tokens.
+	// Optional. Default value writes to the standard logger.
+	Logger func(msg string, fields map[string]interface{})
+
+	// CorrelationID returns an id for each checked request, e.g. the id a
+	// CSP report-uri gets, to match rejections with CSP reports. The id is
+	// sent in CorrelationHeader, added to log events as "correlation_id" and
+	// to Validation and State. With it, rejected tokens are logged as with
+	// Debug.
+	// Optional. Default value nil.
+	CorrelationID func(*fiber.Ctx) string
+
+	// CorrelationHeader is the response header that carries the id of
+	// CorrelationID.
+	// Optional. Default value "X-CSRF-Correlation-ID".
+	CorrelationHeader string
+
+	// Storage keeps server-side token state, e.g. challenge tokens.
+	// Required for ModeSynchronizer, ChallengeHandler and RequireChallenge.
+	Storage Storage
+
+	// StorageKeyHash hashes session identifiers before they become part of
+	// a Storage key, so that raw session ids aren't kept in the store.
+	// Optional. Default value SHA256KeyHash.
+	StorageKeyHash func(string) string
+
+	// ChallengeTTL is how long a challenge token stays valid.
+	// Optional. Default value 1 minute.
+	ChallengeTTL time.Duration
+
+	// ChallengeLookup is a string in the form of "<source>:<key>" that is
+	// used to extract the challenge token from the request.
+	// Optional. Default value "header:X-CSRF-Challenge".
+	ChallengeLookup string
+
+	// RequireSecure rejects requests that were not made over HTTPS with
+	// 403 Forbidden and always marks the CSRF cookie as secure.
+	// Optional. Default value false.
+	RequireSecure bool
+
+	// TrustProxyHeaders makes the middleware honor X-Forwarded-Proto when
+	// deciding whether a request was made over HTTPS. Only enable this
+	// behind a proxy that overwrites the header.
+	// Optional. Default value false.
+	TrustProxyHeaders bool
+
+	// MethodOverrideHeader names a header such as X-HTTP-Method-Override
+	// through which clients tunnel PUT or DELETE over POST or GET. Requests
+	// are validated if the overriding method is unsafe; an override never
+	// exempts an unsafe request.
+	// Optional. Default value "" (ignore overrides).
+	MethodOverrideHeader string
+
+	// SafeMethods replaces the methods that aren't validated, GET, HEAD,
+	// OPTIONS and TRACE by default. Any method not listed, standard or not,
+	// is validated. Fiber itself only routes standard methods, so custom
+	// ones such as PROPFIND only arrive through MethodOverrideHeader.
+	// Optional. Default value nil (the RFC7231 safe methods).
+	SafeMethods []string
+
+	// IsMutating decides whether an unsafe request changes state, e.g. by
+	// peeking at a GraphQL body to tell queries from mutations; requests
+	// it returns false for are treated like safe methods. It may read
+	// c.Body(), which stays available to the handler.
+	// Optional. Default value nil (every unsafe method mutates).
+	IsMutating func(*fiber.Ctx) bool
+
+	// ValidateSafeMethods also requires a valid token on GET, HEAD, OPTIONS
+	// and TRACE requests. Mount a dedicated instance on the routes that need
+	// it, e.g. a Server-Sent Events subscription taking the token from the
+	// query, or combine it with Filter.
+	// Optional. Default value false.
+	ValidateSafeMethods bool
+
+	// ValidateSafeAgainstStorage rejects safe requests with 403 Forbidden
+	// when their cookie token is no longer in Storage, e.g. because it was
+	// revoked, so that pages stop rendering with it at once. The response
+	// sets a fresh cookie. OnValidate receives ErrTokenRevoked. Requires
+	// ModeSynchronizer and can't be combined with TrustCookie.
+	// Optional. Default value false.
+	ValidateSafeAgainstStorage bool
+
+	// TrustSameOriginFetch skips token validation for requests carrying
+	// "Sec-Fetch-Site: same-origin". Browsers set this header themselves and
+	// it can't be forged from another site, but older browsers don't send
+	// it: their requests, like cross-site ones, still require a token.
+	// Optional. Default value false.
+	TrustSameOriginFetch bool
+
+	// TrustXRequestedWith skips token validation for requests carrying
+	// "X-Requested-With: XMLHttpRequest", as sent by many AJAX libraries.
+	// Other sites can't set the header without a CORS preflight, so form
+	// posts still require a token. It is only as strong as the CORS setup:
+	// a policy allowing the header from other origins, with credentials,
+	// or a script injected into the app defeats it, and clients that don't
+	// send the header, like fetch by default, still need a token.
+	// Optional. Default value false.
+	TrustXRequestedWith bool
+
+	// PreValidate runs on every request that is about to be validated, before
+	// the token is extracted. Returning an error stops the request and hands
+	// the error to the app's ErrorHandler, e.g. fiber.NewError(413, ...).
+	// Mount the middleware before body limits, loggers and other middleware
+	// with side effects, so that nothing records a request that this hook or
+	// the token check rejects.
+	// Optional. Default value nil.
+	PreValidate func(*fiber.Ctx) error
+
+	// PolicyHook receives the middleware's Decision on every request, for a
+	// central policy engine enforcing rules such as denying all cross-site
+	// writes whatever their token. Returning an error for an allowed request
+	// vetoes it and hands the error to the app's ErrorHandler. The hook can
+	// only tighten the decision: rejected requests stay rejected and its
+	// error is ignored for them.
+	// Optional. Default value nil.
+	PolicyHook func(*fiber.Ctx, Decision) error
+
+	// CheckOrigin additionally rejects unsafe requests whose Origin host
+	// differs from the request host. Browsers omit Origin on some top-level
+	// form submissions, so a missing Origin is accepted if the Referer host
+	// matches the request host or Sec-Fetch-Site is "same-origin"; requests
+	// which carry none of these headers are rejected.
+	// Optional. Default value false.
+	CheckOrigin bool
+
+	// CanonicalHost is the host CheckOrigin expects in Origin and Referer
+	// instead of the request host, e.g. "app.example.com" when several
+	// ingress hostnames proxy to the same app.
+	// Optional. Default value "" (the request host).
+	CanonicalHost string
+
+	// SafeMethodErrorStatus is the status for missing or invalid tokens on
+	// safe methods validated through ValidateSafeMethods or
+	// ValidateWebSocket, to tell them apart from failures on unsafe methods.
+	// Optional. Default value 0, i.e. 400 for missing and 403 for invalid
+	// tokens like on unsafe methods.
+	SafeMethodErrorStatus int
+
+	// ValidateWebSocket requires a valid token on WebSocket handshakes. As
+	// browsers can't set custom headers on them, the token is read from the
+	// Sec-WebSocket-Protocol entry starting with WebSocketTokenPrefix, e.g.
+	// new WebSocket(url, ["chat", "csrf." + token]). On success the first
+	// other requested subprotocol, or else the token entry, is echoed back.
+	// Optional. Default value false.
+	ValidateWebSocket bool
+
+	// WebSocketTokenPrefix marks the subprotocol carrying the token.
+	// Optional. Default value "csrf.".
+	WebSocketTokenPrefix string
+
+	// IssuanceRateLimit caps how many requests without a valid token to
+	// reuse, i.e. fresh token issuances, a client IP may make per
+	// IssuanceRateWindow. Requests beyond it get 429 Too Many Requests;
+	// clients reusing their cookie are unaffected, while cookies that fail
+	// verification count as issuances. The limit is checked before a token
+	// is minted, so throttled requests generate and store nothing.
+	// ModeSaltedHMAC, which signs a token per response by design, and
+	// TimeBucket tokens aren't counted. Counts are kept in Storage, or in
+	// memory if Storage is nil.
+	// Optional. Default value 0 (unlimited).
+	IssuanceRateLimit int
+
+	// IssuanceRateWindow is the window of IssuanceRateLimit.
+	// Optional. Default value 1 minute.
+	IssuanceRateWindow time.Duration
+
+	// CleanupEvery sweeps expired entries from the in-memory storage the
+	// issuance limiter falls back to without Storage every that many
+	// operations, see NewMemoryStorageWithCleanup.
+	// Optional. Default value 0 (expired entries are removed when read).
+	CleanupEvery int
+
+	// ValidatorWithSubject replaces the built-in token check. Besides
+	// accepting or rejecting the token it returns the subject the token
+	// belongs to, which is stored in the context under SubjectKey for audit
+	// logging. An error rejects the request with 500 Internal Server Error.
+	// Optional. Default value nil.
+	ValidatorWithSubject func(c *fiber.Ctx, clientToken string) (subject string, ok bool, err error)
+
+	// ValidatorCacheTTL caches the results of ValidatorWithSubject per token
+	// for this long, e.g. to spare a remote token service repeated calls.
+	// Results are keyed by the token alone, so only enable it if they don't
+	// depend on anything else in the request. Errors aren't cached.
+	// Optional. Default value 0 (no caching).
+	ValidatorCacheTTL time.Duration
+
+	// ValidatorCacheSize is how many tokens ValidatorCacheTTL keeps; the
+	// least recently used one is evicted first.
+	// Optional. Default value 1024.
+	ValidatorCacheSize int
+
+	// SubjectKey is the context key of the subject from ValidatorWithSubject.
+	// Optional. Default value "csrf_subject".
+	SubjectKey string
+
+	// Name of the readable token cookie in ModeSplitToken.
+	// Optional. Default value "csrf_token".
+	TokenCookieName string
+
+	// Domain of the token cookie in ModeSplitToken.
+	// Optional. Default value none.
+	TokenCookieDomain string
+
+	// Path of the token cookie in ModeSplitToken.
+	// Optional. Default value none.
+	TokenCookiePath string
+
+	// Indicates if the token cookie in ModeSplitToken is HTTP only.
+	// Optional. Default value false.
+	TokenCookieHTTPOnly bool
+
+	// TokenMaxAge is the max age (in seconds) of the token cookie and its
+	// token in ModeSplitToken, for short-lived tokens next to a long-lived
+	// secret cookie. Older tokens are rejected; clients get a fresh one
+	// from TokenRefreshHandler or with the next response.
+	// Optional. Default value 0 (CookieMaxAge, tokens don't expire).
+	TokenMaxAge int
+
+	// SameSite attribute of the token cookie in ModeSplitToken.
+	// Optional. Default value CookieSameSite.
+	TokenCookieSameSite string
+
+	// CompatVersions lists version markers of token formats accepted during
+	// a rolling deployment. A cookie or request token "<version>.<token>"
+	// with a listed version is validated as "<token>", so old and new
+	// binaries can run side by side.
+	// Optional. Default value nil.
+	CompatVersions []string
+
+	// CompressToken flate-compresses signed tokens (ModeHMAC and
+	// ModeSplitToken) and marks them with a leading "~". Compression only
+	// pays off for large tokens; it makes the current ~80 byte format longer.
+	// Compressed and uncompressed tokens are always accepted.
+	// Optional. Default value false.
+	CompressToken bool
+
+	// CookieVersion is a format version marker prepended to cookie values as
+	// "<version>.", so that future validators can route to the right decoder.
+	// Cookies without this marker or one listed in CompatVersions are
+	// treated as absent and reissued. Request tokens may carry the marker.
+	// Optional. Default value "" (no marker).
+	CookieVersion string
+
+	// OnValidate is called after every token validation, e.g. to record
+	// pass/fail counters and a histogram of token ages.
+	// Optional. Default value nil.
+	OnValidate func(*fiber.Ctx, Validation)
+
+	// Now returns the current time. Tokens, links and buckets encode Unix
+	// times and issue times are reported in UTC, so the location of the
+	// returned time, e.g. after a timezone or DST change, doesn't matter.
+	// Optional. Default value time.Now.
+	Now func() time.Time
+
+	// SkipIfHeaderPresent lists request headers, e.g. an API key header,
+	// whose presence makes the middleware skip validation and not issue a
+	// cookie. Machine clients authenticating this way are not exposed to CSRF.
+	// Optional. Default value nil.
+	SkipIfHeaderPresent []string
+
+	// SkipHeaderValidator, if set, must also accept the header value for
+	// SkipIfHeaderPresent to apply. See StaticHeaderValidator.
+	// Optional. Default value nil.
+	SkipHeaderValidator func(header, value string) bool
+
+	// AppendTokenToRedirect adds the token to the query of redirects issued
+	// by the handler, as RedirectTokenParam, when they point to the same
+	// host, so that the next page has it without reading the cookie.
+	// Optional. Default value false.
+	AppendTokenToRedirect bool
+
+	// RedirectTokenParam is the query parameter AppendTokenToRedirect sets.
+	// Optional. Default value "csrf".
+	RedirectTokenParam string
+
+	// CookieRequiredStatus is the status for requests whose token fails
+	// because they carry no CSRF cookie, so that the frontend can tell the
+	// user to enable cookies. OnValidate receives ErrCookieRequired.
+	// Optional. Default value 403 Forbidden, as for any invalid token.
+	CookieRequiredStatus int
+
+	// GeneratorErrorStatus is the status for requests that need a fresh
+	// token when Generator or RandReader fails. The failure is logged and
+	// no cookie is set.
+	// Optional. Default value 500 Internal Server Error.
+	GeneratorErrorStatus int
+
+	// MalformedTokenStatus is the status for requests whose token fails
+	// with ErrTokenMalformed in a signed mode, e.g. 400 Bad Request to tell
+	// broken clients from forged tokens, which fail with ErrBadSignature.
+	// Optional. Default value 403 Forbidden, as for any invalid token.
+	MalformedTokenStatus int
+
+	// RetryStatus, if set, answers unsafe requests that arrive without a CSRF
+	// cookie with this status, a fresh cookie and RetryHeader set to "1",
+	// telling the client to retry with the new token instead of failing.
+	// Only ModeDoubleSubmit and ModeSplitToken need the cookie; other modes
+	// validate without it and ignore RetryStatus.
+	// Optional. Default value 0 (reject like any missing token).
+	RetryStatus int
+
+	// RetryHeader is the response header set along with RetryStatus.
+	// Optional. Default value "X-CSRF-Retry".
+	RetryHeader string
+
+	// HandleOptions answers OPTIONS requests, such as CORS preflights, with
+	// 204 No Content without calling the next handlers. The response carries
+	// the token in the header of the first header lookup, X-CSRF-Token by
+	// default, which is also added to the allowed and exposed CORS headers.
+	// A CORS middleware that answers preflights itself must run earlier.
+	// Optional. Default value false.
+	HandleOptions bool
+
+	// ClearSiteDataOnDelete makes Delete also send
+	// `Clear-Site-Data: "cookies"`, so browsers purge every cookie of the
+	// site, not only the CSRF ones, e.g. on logout.
+	// Optional. Default value false.
+	ClearSiteDataOnDelete bool
+
+	// ShouldIssueCookie decides after the handler ran whether the response
+	// carries the CSRF cookies, e.g. to leave them out of 204 or JSON API
+	// responses. When set, cookies are written after the handler instead of
+	// before it.
+	// Optional. Default value nil (always issue).
+	ShouldIssueCookie func(*fiber.Ctx) bool
+
+	// SkipCookieOnHead doesn't set the CSRF cookies on HEAD responses, e.g.
+	// for uptime probes. HEAD responses otherwise carry them like GET does;
+	// Fiber never writes a body for HEAD either way.
+	// Optional. Default value false.
+	SkipCookieOnHead bool
+}
+
+// New ... Several configs are merged in order, so that New(ProdConfig(nil),
+// Config{...}) applies overrides on top of a preset. Only fields an override
+// sets to a non-zero value win, so it can't turn off a flag of the preset;
+// change the preset itself for that, e.g. cfg := DevConfig(); cfg.Debug =
+// false.
+func New(config ...Config) func(*fiber.Ctx) {
+	cfg := configDefault(config...)
+	extractor := newExtractor(cfg.TokenLookup, cfg.RequireAllSources, cfg.MaxSourceAttempts, cfg.DuplicateTokenFields)
+	wsExtractor := csrfFromSubprotocol(cfg.WebSocketTokenPrefix)
+	optionsHeader := "X-CSRF-Token"
+	for _, lookup := range strings.Split(cfg.TokenLookup, ",") {
+		if parts := strings.Split(strings.TrimSpace(lookup), ":"); parts[0] == "header" {
+			optionsHeader = parts[1]
+			break
+		}
+	}
+	var cache *validatorCache
+	if cfg.ValidatorCacheTTL > 0 {
+		cache = newValidatorCache(cfg.ValidatorCacheSize, cfg.ValidatorCacheTTL, cfg.Now)
+	}
+	var issuance *limiter
+	if cfg.IssuanceRateLimit > 0 {
+		issuance = &limiter{
+			storage: cfg.Storage,
+			prefix:  "issuance:",
+			limit:   cfg.IssuanceRateLimit,
+			window:  cfg.IssuanceRateWindow,
+			now:     cfg.Now,
+		}
+		if issuance.storage == nil {
+			issuance.storage = NewMemoryStorageWithCleanup(cfg.CleanupEvery)
+		}
+	}
+	return withPolicyHook(cfg, func(c *fiber.Ctx) {
+		// Filter request to skip middleware
+		if cfg.Filter != nil && cfg.Filter(c) {
+			c.Locals(reasonKey, ReasonFiltered)
+			if allow(c, cfg, "") {
+				c.Next()
+			}
+			return
+		}
+		if containsPath(cfg.ExemptPaths, c.Path(), cfg.StrictPaths) {
+			c.Locals(reasonKey, ReasonExemptPath)
+			if allow(c, cfg, "") {
+				c.Next()
+			}
+			return
+		}
+		if skipByHeader(c, cfg) {
+			c.Locals(reasonKey, ReasonSkipHeader)
+			if allow(c, cfg, "") {
+				c.Next()
+			}
+			return
+		}
+		if cfg.CorrelationID != nil {
+			id := cfg.CorrelationID(c)
+			c.Locals(correlationKey, id)
+			c.Set(cfg.CorrelationHeader, id)
+		}
+		timer := newDebugTimer(cfg, c)
+		if timer != nil {
+			defer timer.report(c, cfg)
+		}
+		if cfg.Debug && c.Locals(cfg.ContextKey) != nil {
+			logEvent(c, cfg, "context key already set by another middleware", map[string]interface{}{
+				"key":  cfg.ContextKey,
+				"path": logPath(c, cfg),
+			})
+		}
+		if cfg.EmitProtectionHeader {
+			c.Set(cfg.ProtectionHeader, "1")
+		}
+		if cfg.RequireSecure && !isSecure(c, cfg.TrustProxyHeaders) {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		hasCookie := readCookie(c, cfg, cfg.CookieName) != ""
+		b, err := newBinding(c, cfg)
+		if err != nil {
+			// Fail closed if the signing key is unavailable
+			c.SendStatus(fiber.StatusServiceUnavailable)
+			return
+		}
+		timer.begin()
+		secret, token, err := loadToken(c, cfg, &b)
+		timer.end("storage")
+		if err == ErrStorageCookieMismatch {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		} else if err != nil {
+			sendTokenError(c, cfg, err)
+			return
+		}
+		// issue mints the pending token, if any, once IssuanceRateLimit
+		// allows it. It responds and returns false otherwise.
+		issue := func() bool {
+			if !b.pending {
+				return true
+			}
+			if issuance != nil && b.issued {
+				ok, reset, err := issuance.allow(c.IP())
+				if err != nil {
+					c.SendStatus(fiber.StatusInternalServerError)
+					return false
+				}
+				if !ok {
+					// Whole seconds, rounded up so clients don't retry too early
+					c.Set(fiber.HeaderRetryAfter, strconv.FormatInt(int64((reset+time.Second-1)/time.Second), 10))
+					c.SendStatus(fiber.StatusTooManyRequests)
+					return false
+				}
+			}
+			loaded := secret
+			var err error
+			if secret, token, err = issueToken(cfg, b, secret); err != nil {
+				sendTokenError(c, cfg, err)
+				return false
+			}
+			b.pending = false
+			if loaded == "" {
+				guardTokens(c, cfg, secret, token)
+			} else {
+				// The secret cookie of ModeSplitToken is whatever the client sent
+				guardTokens(c, cfg, token)
+			}
+			return true
+		}
+		// overridden is set when the expected token doesn't come from the cookie
+		overridden := false
+		if expected, ok := expectedToken(c, cfg); ok {
+			secret, token, b.history, overridden = expected, expected, nil, true
+		}
+		if cfg.EdgeTokenHeader != "" && c.Get(cfg.EdgeTokenHeader) != "" {
+			edge, ok := verifyEdgeToken(cfg.EdgeSecret, c.Get(cfg.EdgeTokenHeader))
+			if !ok {
+				c.SendStatus(fiber.StatusForbidden)
+				return
+			}
+			secret, token, overridden = edge, edge, true
+		}
+		if forced, ok := debugToken(c, cfg); ok {
+			secret, token, b.history, overridden = forced, forced, nil, true
+		}
+		if overridden {
+			b.pending = false
+		}
+		// issue guards the token it mints. Of the others only those read from
+		// Storage are the server's: cookies and the tokens of overrides, e.g.
+		// EdgeTokenHeader, are whatever the client sent.
+		if !b.pending && !overridden && cfg.Mode == ModeSynchronizer && cfg.OnStorageCookieMismatch != TrustCookie {
+			guardTokens(c, cfg, token)
+		}
+		// Validate token only for requests which are not defined as 'safe' by RFC7231
+		safe := isSafeMethod(cfg, c.Method())
+		if b.method != c.Method() && !isSafeMethod(cfg, b.method) {
+			// The request tunnels an unsafe method
+			safe = false
+		}
+		if !safe && cfg.IsMutating != nil {
+			safe = !cfg.IsMutating(c)
+		}
+		if cfg.ValidateSafeAgainstStorage && safe && hasCookie && !overridden && !checkToken(cfg, b, secret, token, readCookie(c, cfg, cfg.CookieName)) {
+			// The cookie token was revoked, hand out the fresh one
+			if cfg.OnValidate != nil {
+				cfg.OnValidate(c, Validation{Err: ErrTokenRevoked})
+			}
+			if !issue() {
+				return
+			}
+			writeCookies(c, cfg, secret, token)
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		handshake := cfg.ValidateWebSocket && isWebSocketHandshake(c)
+		sameOrigin := cfg.TrustSameOriginFetch && c.Get("Sec-Fetch-Site") == "same-origin"
+		xhr := cfg.TrustXRequestedWith && c.XHR()
+		if (!safe || cfg.ValidateSafeMethods || handshake) && !sameOrigin && !xhr {
+			extract := extractor
+			if handshake {
+				extract = wsExtractor
+			}
+			missingStatus, invalidStatus := fiber.StatusBadRequest, fiber.StatusForbidden
+			if safe && cfg.SafeMethodErrorStatus != 0 {
+				missingStatus, invalidStatus = cfg.SafeMethodErrorStatus, cfg.SafeMethodErrorStatus
+			}
+			if cfg.PreValidate != nil {
+				if err := cfg.PreValidate(c); err != nil {
+					c.Next(err)
+					return
+				}
+			}
+			if cfg.CheckOrigin && !safe && !originAllowed(c, cfg.CanonicalHost) {
+				c.SendStatus(fiber.StatusForbidden)
+				return
+			}
+			if cfg.RetryStatus != 0 && !safe && !hasCookie && cookieBound(cfg) && !cfg.VerifyOnly {
+				// Hand out a cookie and let the client retry with its token
+				if !issue() {
+					return
+				}
+				writeCookies(c, cfg, secret, token)
+				c.Set(cfg.RetryHeader, "1")
+				c.SendStatus(cfg.RetryStatus)
+				return
+			}
+			timer.begin()
+			clientToken, err := extract(c)
+			timer.end("extract")
+			if err != nil {
+				if cfg.OnValidate != nil {
+					cfg.OnValidate(c, Validation{})
+				}
+				if err == ErrSourcesDisagree || err == ErrDuplicateToken {
+					c.SendStatus(invalidStatus)
+				} else if handler := missingTokenHandler(c, cfg); handler != nil {
+					handler(c)
+				} else {
+					c.SendStatus(missingStatus)
+				}
+				return
+			}
+			clientToken = stripVersion(clientToken, tokenVersions(cfg))
+			if cfg.EnforceTokenLength && len(clientToken) != int(cfg.TokenLength) {
+				if cfg.OnValidate != nil {
+					cfg.OnValidate(c, Validation{Err: ErrTokenLength})
+				}
+				c.SendStatus(invalidStatus)
+				return
+			}
+			if isBlocked(c, cfg, clientToken) {
+				if cfg.OnValidate != nil {
+					cfg.OnValidate(c, Validation{Err: ErrTokenBlocked})
+				}
+				c.SendStatus(fiber.StatusForbidden)
+				return
+			}
+			if !overridden && cfg.ValidatorWithSubject == nil {
+				never, err := neverIssued(cfg, clientToken)
+				if err != nil {
+					c.SendStatus(fiber.StatusInternalServerError)
+					return
+				}
+				if never {
+					if cfg.OnValidate != nil {
+						cfg.OnValidate(c, Validation{Err: ErrTokenNotIssued})
+					}
+					c.SendStatus(fiber.StatusForbidden)
+					return
+				}
+			}
+			valid := false
+			timer.begin()
+			if cfg.ValidatorWithSubject != nil {
+				cached, hit := validation{}, false
+				if cache != nil {
+					cached, hit = cache.get(clientToken)
+				}
+				subject, ok := cached.subject, cached.ok
+				if !hit {
+					var err error
+					subject, ok, err = cfg.ValidatorWithSubject(c, clientToken)
+					if err != nil {
+						c.SendStatus(fiber.StatusInternalServerError)
+						return
+					}
+					if cache != nil {
+						cache.add(clientToken, subject, ok)
+					}
+				}
+				if valid = ok; valid {
+					c.Locals(cfg.SubjectKey, subject)
+				}
+			} else {
+				valid = checkToken(cfg, b, secret, token, clientToken)
+				if valid && b.pending && cfg.HashToken != nil {
+					// The client holds the plaintext of a stored hash
+					secret, token, b.pending = clientToken, clientToken, false
+				}
+			}
+			timer.end("compare")
+			var reason error
+			if !valid && !hasCookie && !overridden && cfg.ValidatorWithSubject == nil && cookieBound(cfg) {
+				// The token can't match a cookie the browser never sent
+				reason, invalidStatus = ErrCookieRequired, cfg.CookieRequiredStatus
+			} else if !valid && cfg.ValidatorWithSubject == nil && signedMode(cfg) {
+				if signedTokenWellFormed(clientToken, cfg.Mode == ModeHMAC && cfg.TimeBucket > 0) {
+					reason = signedTokenReason(cfg, b, secret, clientToken)
+				} else {
+					reason, invalidStatus = ErrTokenMalformed, cfg.MalformedTokenStatus
+				}
+			}
+			if cfg.OnValidate != nil {
+				v := Validation{Valid: valid, Err: reason}
+				if issued, ok := tokenIssuedAt(clientToken); ok && valid {
+					v.Age, v.HasAge = cfg.Now().Sub(issued), true
+				}
+				cfg.OnValidate(c, v)
+			}
+			if !valid {
+				if cfg.Debug || cfg.CorrelationID != nil {
+					fields := map[string]interface{}{
+						"path":   logPath(c, cfg),
+						"method": c.Method(),
+						"source": c.Locals(sourceKey),
+					}
+					if reason != nil {
+						fields["reason"] = reason.Error()
+					}
+					logEvent(c, cfg, "token rejected", fields)
+				}
+				c.SendStatus(invalidStatus)
+				return
+			}
+			c.Locals(reasonKey, ReasonValidated)
+		} else if sameOrigin {
+			c.Locals(reasonKey, ReasonSameOrigin)
+		} else if xhr {
+			c.Locals(reasonKey, ReasonXRequestedWith)
+		} else {
+			c.Locals(reasonKey, ReasonSafeMethod)
+		}
+		if handshake {
+			echoSubprotocol(c, cfg.WebSocketTokenPrefix)
+		}
+		// Consult PolicyHook before anything is issued or stored
+		if !allow(c, cfg, token) {
+			return
+		}
+		// A shared cache would hand the token of a cacheable response to
+		// every visitor, so none is issued or set there
+		cacheable := containsPath(cfg.CacheablePaths, c.Path(), cfg.StrictPaths)
+		if !cacheable && !issue() {
+			return
+		}
+		// Set CSRF cookie, unless ShouldIssueCookie decides after the handler
+		skipCookie := cacheable || (cfg.SkipCookieOnHead && c.Method() == fiber.MethodHead)
+		if cfg.ShouldIssueCookie == nil && !skipCookie {
+			writeCookies(c, cfg, secret, token)
+		}
+
+		// Store token in context
+		if !cacheable {
+			storeToken(c, cfg, token)
+		}
+
+		// Protect clients from caching the response
+		if !cacheable {
+			appendVary(c, cfg.VaryExclude, fiber.HeaderCookie)
+			if cfg.EarlyTokenHeader != "" && (c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead) {
+				c.Set(cfg.EarlyTokenHeader, token)
+			}
+		}
+
+		if cfg.HandleOptions && c.Method() == fiber.MethodOptions {
+			c.Set(optionsHeader, token)
+			appendHeaderList(c, fiber.HeaderAccessControlAllowHeaders, nil, optionsHeader)
+			appendHeaderList(c, fiber.HeaderAccessControlExposeHeaders, nil, optionsHeader)
+			c.SendStatus(fiber.StatusNoContent)
+			if cfg.ShouldIssueCookie != nil && !skipCookie && cfg.ShouldIssueCookie(c) {
+				writeCookies(c, cfg, secret, token)
+			}
+			return
+		}
+
+		c.Next()
+
+		if cfg.ShouldIssueCookie != nil && !skipCookie && cfg.ShouldIssueCookie(c) {
+			writeCookies(c, cfg, secret, token)
+		}
+		if cfg.AppendTokenToRedirect && !cacheable {
+			appendTokenToRedirect(c, cfg.RedirectTokenParam, token)
+		}
+	})
+}
+
+// configDefault returns the first config with defaults applied.
+func configDefault(config ...Config) Config {
+	// Init config
+	var cfg Config
+	if len(config) > 0 {
+		cfg = config[0]
+		for _, override := range config[1:] {
+			cfg = mergeConfig(cfg, override)
+		}
+	}
+	if cfg.CookieRequiredStatus == 0 {
+		cfg.CookieRequiredStatus = fiber.StatusForbidden
+	}
+	if cfg.CorrelationHeader == "" {
+		cfg.CorrelationHeader = "X-CSRF-Correlation-ID"
+	}
+	if cfg.CorrelationID != nil && cfg.OnValidate != nil {
+		onValidate := cfg.OnValidate
+		cfg.OnValidate = func(c *fiber.Ctx, v Validation) {
+			v.CorrelationID, _ = c.Locals(correlationKey).(string)
+			onValidate(c, v)
+		}
+	}
+	if cfg.GeneratorErrorStatus == 0 {
+		cfg.GeneratorErrorStatus = fiber.StatusInternalServerError
+	}
+	if cfg.MalformedTokenStatus == 0 {
+		cfg.MalformedTokenStatus = fiber.StatusForbidden
+	}
+	if cfg.ValidatorCacheSize <= 0 {
+		cfg.ValidatorCacheSize = 1024
+	}
+	if cfg.RetryHeader == "" {
+		cfg.RetryHeader = "X-CSRF-Retry"
+	}
+	if cfg.RedirectTokenParam == "" {
+		cfg.RedirectTokenParam = "csrf"
+	}
+	if cfg.CookieSameSite == "" {
+		cfg.CookieSameSite = "Lax"
+	}
+	if cfg.TokenCookieSameSite == "" {
+		cfg.TokenCookieSameSite = cfg.CookieSameSite
+	}
+	if cfg.EnforceTokenLength && cfg.ValidatorWithSubject == nil {
+		if cfg.Mode != ModeDoubleSubmit && cfg.Mode != ModeSynchronizer {
+			panic("csrf: EnforceTokenLength requires ModeDoubleSubmit or ModeSynchronizer")
+		}
+		if cfg.Generator == nil && cfg.Alphabet == "" {
+			// UUIDGenerator tokens always have 36 characters
+			if cfg.TokenLength == 0 {
+				cfg.TokenLength = 36
+			} else if cfg.TokenLength != 36 {
+				panic("csrf: EnforceTokenLength with UUIDGenerator requires TokenLength 36")
+			}
+		}
+	}
+	if cfg.TokenLength == 0 {
+		cfg.TokenLength = 32
+	}
+	if cfg.TokenLookup == "" {
+		cfg.TokenLookup = "header:X-CSRF-Token"
+	}
+	for lookup := range cfg.MissingTokenHandlers {
+		if !containsLookup(cfg.TokenLookup, lookup) {
+			panic("csrf: MissingTokenHandlers source " + lookup + " is not in TokenLookup")
+		}
+	}
+	if cfg.ContextKey == "" {
+		cfg.ContextKey = "csrf"
+	}
+	if cfg.CookieName == "" {
+		cfg.CookieName = "_csrf"
+	}
+	if cfg.CookieMaxAge == 0 {
+		cfg.CookieMaxAge = 86400
+	}
+	if cfg.RandReader == nil {
+		cfg.RandReader = rand.Reader
+	}
+	fromAlphabet := cfg.Generator == nil && cfg.Alphabet != ""
+	if fromAlphabet {
+		cfg.Generator = AlphabetGenerator(cfg.Alphabet, int(cfg.TokenLength))
+	}
+	defaultGenerator := cfg.Generator == nil
+	if defaultGenerator {
+		cfg.Generator = UUIDGenerator
+	}
+	if cfg.ProtectionHeader == "" {
+		cfg.ProtectionHeader = "X-CSRF-Protection"
+	}
+	if cfg.Now == nil {
+		cfg.Now = time.Now
+	}
+	if cfg.SubjectKey == "" {
+		cfg.SubjectKey = "csrf_subject"
+	}
+	if cfg.IssuanceRateWindow == 0 {
+		cfg.IssuanceRateWindow = time.Minute
+	}
+	if cfg.WebSocketTokenPrefix == "" {
+		cfg.WebSocketTokenPrefix = "csrf."
+	}
+	if cfg.TokenCookieName == "" {
+		cfg.TokenCookieName = "csrf_token"
+	}
+	if cfg.DebugTokenKey == "" {
+		cfg.DebugTokenKey = "csrf_debug_token"
+	}
+	if cfg.StorageKeyHash == nil {
+		cfg.StorageKeyHash = SHA256KeyHash
+	}
+	if cfg.ChallengeTTL == 0 {
+		cfg.ChallengeTTL = time.Minute
+	}
+	if cfg.ChallengeLookup == "" {
+		cfg.ChallengeLookup = "header:X-CSRF-Challenge"
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = func(msg string, fields map[string]interface{}) {
+			log.Printf("csrf: %s %v", msg, fields)
+		}
+	}
+	if bits := alphabetBits(cfg.Alphabet, int(cfg.TokenLength)); fromAlphabet && bits < minTokenBits {
+		cfg.Logger("tokens are short enough to be guessed", map[string]interface{}{
+			"bits": int(bits),
+		})
+	}
+	if cfg.Mode == ModeHMAC && ((len(cfg.Secret) == 0 && cfg.KeyFunc == nil) || cfg.SessionKey == nil) {
+		panic("csrf: ModeHMAC requires Secret or KeyFunc, and SessionKey")
+	}
+	if cfg.Mode == ModeSaltedHMAC && ((len(cfg.Secret) == 0 && cfg.KeyFunc == nil) || cfg.SessionKey == nil) {
+		panic("csrf: ModeSaltedHMAC requires Secret or KeyFunc, and SessionKey")
+	}
+	if cfg.VerifyOnly && cfg.Mode != ModeHMAC && cfg.Mode != ModeSaltedHMAC {
+		panic("csrf: VerifyOnly requires ModeHMAC or ModeSaltedHMAC")
+	}
+	if cfg.MigratePlainTokens && cfg.Mode != ModeHMAC {
+		panic("csrf: MigratePlainTokens requires ModeHMAC")
+	}
+	if cfg.AllowedMethods != nil && (cfg.Mode == ModeDoubleSubmit || cfg.Mode == ModeSynchronizer || cfg.TimeBucket > 0) {
+		panic("csrf: AllowedMethods requires ModeHMAC, ModeSaltedHMAC or ModeSplitToken without TimeBucket")
+	}
+	if len(cfg.FingerprintHeaders) > 0 && (cfg.Mode == ModeDoubleSubmit || cfg.Mode == ModeSynchronizer) {
+		panic("csrf: FingerprintHeaders requires ModeHMAC, ModeSaltedHMAC or ModeSplitToken")
+	}
+	if cfg.EdgeTokenHeader != "" && (len(cfg.EdgeSecret) == 0 || cfg.Mode != ModeDoubleSubmit) {
+		panic("csrf: EdgeTokenHeader requires EdgeSecret and ModeDoubleSubmit")
+	}
+	if cfg.CookieDisabled && cfg.ValidatorWithSubject == nil && (cfg.Mode == ModeSplitToken ||
+		(cfg.Mode == ModeDoubleSubmit && cfg.ExpectedTokenKey == "" && cfg.EdgeTokenHeader == "")) {
+		panic("csrf: CookieDisabled requires a mode that doesn't validate against the cookie")
+	}
+	if cfg.Mode == ModeSynchronizer && (cfg.Storage == nil || cfg.SessionKey == nil) {
+		panic("csrf: ModeSynchronizer requires Storage and SessionKey")
+	}
+	if cfg.TokenEncoding != "" && cfg.TokenEncoding != "hex" && cfg.TokenEncoding != "base64" {
+		panic("csrf: TokenEncoding must be \"hex\" or \"base64\"")
+	}
+	if cfg.TokenEncoding != "" && (cfg.EnforceTokenLength || cfg.HashVerify != nil) {
+		panic("csrf: TokenEncoding can't be combined with EnforceTokenLength or HashVerify")
+	}
+	if cfg.TokenEncoding != "" && defaultGenerator {
+		// UUIDGenerator tokens decode as neither, nothing would validate
+		panic("csrf: TokenEncoding requires a Generator or Alphabet of encoded tokens")
+	}
+	if cfg.HashVerify != nil && cfg.Mode == ModeDoubleSubmit && cfg.ExpectedTokenKey == "" {
+		panic("csrf: HashVerify with ModeDoubleSubmit requires ExpectedTokenKey")
+	}
+	if cfg.HashVerify != nil && cfg.Mode == ModeSynchronizer && cfg.HashToken == nil {
+		panic("csrf: HashVerify with ModeSynchronizer requires HashToken")
+	}
+	if cfg.HashToken != nil && (cfg.HashVerify == nil || cfg.Mode != ModeSynchronizer || cfg.OnStorageCookieMismatch == TrustCookie) {
+		panic("csrf: HashToken requires HashVerify and ModeSynchronizer without TrustCookie")
+	}
+	if cfg.ValidateSafeAgainstStorage && (cfg.Mode != ModeSynchronizer || cfg.OnStorageCookieMismatch == TrustCookie) {
+		panic("csrf: ValidateSafeAgainstStorage requires ModeSynchronizer without TrustCookie")
+	}
+	return cfg
+}
+
+// binding holds what the tokens of a request are bound to.
+type binding struct {
+	// session is the session of the request if the mode binds tokens to one.
+	session string
+	// key signs tokens in ModeHMAC and ModeSaltedHMAC.
+	key []byte
+	// history holds the tokens of the session kept in ModeSynchronizer,
+	// newest first, when HistorySize is above 1.
+	history []string
+	// fingerprint is the hex SHA-256 of the FingerprintHeaders, if any.
+	fingerprint string
+	// allowed lists the methods tokens issued for the request are valid
+	// for, as returned by AllowedMethods.
+	allowed []string
+	// method is the method the request acts with: the MethodOverrideHeader
+	// method if present, otherwise the request method.
+	method string
+	// legacy is the unsigned CSRF cookie under MigratePlainTokens.
+	legacy string
+	// issued is set by loadToken when the request had no valid token to
+	// reuse, so that a fresh one counts against IssuanceRateLimit.
+	issued bool
+	// pending is set by loadToken when the token of the request still has
+	// to be minted by issueToken.
+	pending bool
+}
+
+// signed returns what signed tokens are bound to: the session followed by
+// the fixed-size fingerprint, so that no two pairs sign the same input.
+func (b binding) signed() string {
+	return b.session + b.fingerprint
+}
+
+// newBinding resolves the binding of a request. Errors come from KeyFunc.
+func newBinding(c *fiber.Ctx, cfg Config) (binding, error) {
+	b := binding{method: c.Method()}
+	if cfg.MethodOverrideHeader != "" {
+		if override := c.Get(cfg.MethodOverrideHeader); override != "" {
+			b.method = strings.ToUpper(override)
+		}
+	}
+	if cfg.AllowedMethods != nil {
+		b.allowed = cfg.AllowedMethods(c)
+	}
+	if cfg.Mode == ModeHMAC || cfg.Mode == ModeSaltedHMAC || cfg.Mode == ModeSynchronizer {
+		b.session = cfg.SessionKey(c)
+	}
+	if len(cfg.FingerprintHeaders) > 0 {
+		var fp strings.Builder
+		for _, header := range cfg.FingerprintHeaders {
+			// Header values can't hold newlines, so the encoding is unambiguous
+			fp.WriteString(header + ":" + c.Get(header) + "\n")
+		}
+		b.fingerprint = SHA256KeyHash(fp.String())
+	}
+	if cfg.Mode == ModeHMAC || cfg.Mode == ModeSaltedHMAC {
+		b.key = cfg.Secret
+		if cfg.KeyFunc != nil {
+			key, err := cfg.KeyFunc(c)
+			if err != nil {
+				return b, err
+			}
+			b.key = key
+		}
+		if cfg.DeriveSessionKeys {
+			b.key = deriveKey(b.key, b.session)
+		}
+	}
+	return b, nil
+}
+
+// expectedToken returns the token an upstream middleware stored under
+// ExpectedTokenKey, if any.
+func expectedToken(c *fiber.Ctx, cfg Config) (string, bool) {
+	if cfg.ExpectedTokenKey == "" || (cfg.Mode != ModeDoubleSubmit && cfg.Mode != ModeSynchronizer) {
+		return "", false
+	}
+	expected, ok := c.Locals(cfg.ExpectedTokenKey).(string)
+	return expected, ok && expected != ""
+}
+
+// debugToken returns the token forced through DebugTokenKey, if any.
+func debugToken(c *fiber.Ctx, cfg Config) (string, bool) {
+	if !cfg.Debug || (cfg.Mode != ModeDoubleSubmit && cfg.Mode != ModeSynchronizer) {
+		return "", false
+	}
+	forced, ok := c.Locals(cfg.DebugTokenKey).(string)
+	return forced, ok && forced != ""
+}
+
+// loadToken returns the secret stored in the CSRF cookie and the token handed
+// to clients. Both are the same value unless Mode is ModeSplitToken. Where
+// the cookies are missing or invalid it marks the token pending instead of
+// minting one, so that nothing is generated or stored for requests that are
+// then rejected; see issueToken.
+func loadToken(c *fiber.Ctx, cfg Config, b *binding) (secret, token string, err error) {
+	if cfg.Mode == ModeSynchronizer {
+		stored, err := cfg.Storage.Get(storageKey(cfg, b.session))
+		if err != nil {
+			return "", "", err
+		}
+		history := strings.Fields(string(stored))
+		if len(history) == 0 {
+			b.issued, b.pending = true, true
+			return "", "", nil
+		}
+		if cfg.HashToken != nil {
+			return loadHashedToken(c, cfg, b, history)
+		}
+		token = history[0]
+		if cfg.HistorySize > 1 {
+			b.history = history
+		}
+		if cookie := readCookie(c, cfg, cfg.CookieName); !cfg.CookieDisabled && cookie != "" && cookie != token {
+			switch cfg.OnStorageCookieMismatch {
+			case TrustCookie:
+				exp := time.Duration(cfg.CookieMaxAge) * time.Second
+				if err := cfg.Storage.Set(storageKey(cfg, b.session), []byte(cookie), exp); err != nil {
+					return "", "", err
+				}
+				token = cookie
+			case RejectMismatch:
+				return "", "", ErrStorageCookieMismatch
+			default:
+				logEvent(c, cfg, "storage and cookie tokens differ, using storage", map[string]interface{}{
+					"path": logPath(c, cfg),
+				})
+			}
+		}
+		return token, token, nil
+	}
+	if cfg.VerifyOnly {
+		// The issuing service owns the cookie, only pass on a genuine token
+		token = readCookie(c, cfg, cfg.CookieName)
+		if cfg.TimeBucket > 0 && cfg.Mode == ModeHMAC {
+			if !verifyBucketToken(b.key, b.signed(), token, cfg.Now(), cfg.TimeBucket) {
+				token = ""
+			}
+		} else if !verifyHMACToken(b.key, b.signed(), token) {
+			token = ""
+		}
+		return token, token, nil
+	}
+	if cfg.Mode == ModeHMAC && cfg.MigratePlainTokens {
+		if cookie := readCookie(c, cfg, cfg.CookieName); cookie != "" && !signedTokenWellFormed(cookie, cfg.TimeBucket > 0) {
+			b.legacy = cookie
+		}
+	}
+	if (cfg.Mode == ModeHMAC && cfg.TimeBucket > 0) || cfg.Mode == ModeSaltedHMAC {
+		// Minted for every request, they don't count as issuance
+		b.pending = true
+		return "", "", nil
+	}
+	secret = readCookie(c, cfg, cfg.CookieName)
+	if cfg.Mode == ModeHMAC && secret != "" && !verifyHMACToken(b.key, b.signed(), secret) {
+		// Cookie was issued for another session
+		secret = ""
+	}
+	if secret == "" {
+		b.issued, b.pending = true, true
+		return "", "", nil
+	}
+	if cfg.Mode != ModeSplitToken {
+		return secret, secret, nil
+	}
+	token = readCookie(c, cfg, cfg.TokenCookieName)
+	if token == "" || !verifyHMACToken([]byte(secret), b.signed(), token) || tokenExpired(cfg, token) {
+		b.issued, b.pending = true, true
+		return secret, "", nil
+	}
+	return secret, token, nil
+}
+
+// loadHashedToken is loadToken for the hashes HashToken keeps in Storage.
+// The token is the cookie, if it verifies against one of them.
+func loadHashedToken(c *fiber.Ctx, cfg Config, b *binding, history []string) (secret, token string, err error) {
+	b.history = history
+	if cookie := readCookie(c, cfg, cfg.CookieName); !cfg.CookieDisabled && cookie != "" {
+		if checkToken(cfg, *b, cookie, cookie, cookie) {
+			return cookie, cookie, nil
+		}
+		if cfg.OnStorageCookieMismatch == RejectMismatch {
+			return "", "", ErrStorageCookieMismatch
+		}
+	}
+	// The session has a token, only its plaintext is unknown, so minting
+	// another doesn't count as issuance
+	b.pending = true
+	return "", "", nil
+}
+
+// issueToken mints the token loadToken left pending: a fresh secret and
+// token, or only a fresh token for the secret cookie of ModeSplitToken.
+func issueToken(cfg Config, b binding, secret string) (string, string, error) {
+	if cfg.Mode == ModeSplitToken && secret != "" {
+		token, err := signToken(cfg, []byte(secret), b)
+		return secret, token, err
+	}
+	return newToken(cfg, b)
+}
+
+// newToken issues a fresh secret and token.
+func newToken(cfg Config, b binding) (secret, token string, err error) {
+	switch cfg.Mode {
+	case ModeHMAC:
+		if cfg.TimeBucket > 0 {
+			token = bucketToken(b.key, b.signed(), cfg.Now(), cfg.TimeBucket)
+			return token, token, addIssued(cfg, token)
+		}
+		token, err = signToken(cfg, b.key, b)
+		return token, token, err
+	case ModeSaltedHMAC:
+		token, err = signToken(cfg, b.key, b)
+		return token, token, err
+	case ModeSplitToken:
+		if secret, err = generate(cfg); err != nil {
+			return "", "", err
+		}
+		token, err = signToken(cfg, []byte(secret), b)
+		return secret, token, err
+	case ModeSynchronizer:
+		if token, err = generate(cfg); err != nil {
+			return "", "", err
+		}
+		if err = addIssued(cfg, token); err != nil {
+			return "", "", err
+		}
+		history := []string{token}
+		if cfg.HashToken != nil {
+			history[0] = cfg.HashToken(token)
+		}
+		if cfg.HistorySize > 1 {
+			stored, err := cfg.Storage.Get(storageKey(cfg, b.session))
+			if err != nil {
+				return "", "", err
+			}
+			history = append(history, strings.Fields(string(stored))...)
+			if len(history) > cfg.HistorySize {
+				history = history[:cfg.HistorySize]
+			}
+		}
+		exp := time.Duration(cfg.CookieMaxAge) * time.Second
+		if err = cfg.Storage.Set(storageKey(cfg, b.session), []byte(strings.Join(history, " ")), exp); err != nil {
+			return "", "", err
+		}
+		return token, token, nil
+	}
+	if token, err = generate(cfg); err != nil {
+		return "", "", err
+	}
+	return token, token, addIssued(cfg, token)
+}
+
+// generate returns a fresh token of Generator.
+func generate(cfg Config) (string, error) {
+	token, err := cfg.Generator(cfg.RandReader, cfg.Now())
+	if err != nil {
+		return "", generateError{err}
+	}
+	if token == "" {
+		return "", generateError{errEmptyToken}
+	}
+	return token, nil
+}
 
-	// TokenLookup is a string in the form of "<source>:<key>" that is used
-	// to extract token from the request.
-	// Optional. Default value "header:X-CSRF-Token".
-	// Possible values:
-	// - "header:<name>"
-	// - "form:<name>"
-	// - "query:<name>"
-	TokenLookup string
+// sendTokenError responds to an error of loadToken or newToken.
+func sendTokenError(c *fiber.Ctx, cfg Config, err error) {
+	if _, ok := err.(generateError); !ok {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return
+	}
+	logEvent(c, cfg, "token generation failed", map[string]interface{}{
+		"path":  logPath(c, cfg),
+		"error": err.Error(),
+	})
+	c.SendStatus(cfg.GeneratorErrorStatus)
+}
 
-	// Context key to store generated CSRF token into context.
-	// Optional. Default value "csrf".
-	ContextKey string
+// signToken issues a signed token bound to b, compressed if CompressToken is
+// set.
+func signToken(cfg Config, key []byte, b binding) (string, error) {
+	token, err := generateHMACToken(cfg.RandReader, key, b.signed(), b.allowed, cfg.Now())
+	if err != nil {
+		return "", generateError{err}
+	}
+	if cfg.CompressToken {
+		token = compressToken(token)
+	}
+	return token, addIssued(cfg, token)
+}
 
-	// Name of the CSRF cookie. This cookie will store CSRF token.
-	// Optional. Default value "csrf".
-	CookieName string
+// storageKey returns the Storage key of the token of a session.
+func storageKey(cfg Config, session string) string {
+	return "token:" + cfg.StorageKeyHash(session)
+}
 
-	// Domain of the CSRF cookie.
-	// Optional. Default value none.
-	CookieDomain string
+// checkToken reports whether clientToken is valid given the secret and token
+// returned by loadToken.
+func checkToken(cfg Config, b binding, secret, token, clientToken string) bool {
+	if testToken != "" && subtle.ConstantTimeCompare([]byte(testToken), []byte(clientToken)) == 1 {
+		return true
+	}
+	switch cfg.Mode {
+	case ModeHMAC:
+		if b.legacy != "" && subtle.ConstantTimeCompare([]byte(b.legacy), []byte(clientToken)) == 1 {
+			return true
+		}
+		if cfg.TimeBucket > 0 {
+			return verifyBucketToken(b.key, b.signed(), clientToken, cfg.Now(), cfg.TimeBucket)
+		}
+		return verifyHMACToken(b.key, b.signed(), clientToken) && methodAllowed(clientToken, b.method)
+	case ModeSaltedHMAC:
+		return verifyHMACToken(b.key, b.signed(), clientToken) && methodAllowed(clientToken, b.method)
+	case ModeSplitToken:
+		// A pending secret has no key to verify against
+		return secret != "" && verifyHMACToken([]byte(secret), b.signed(), clientToken) && methodAllowed(clientToken, b.method) && !tokenExpired(cfg, clientToken)
+	}
+	if len(b.history) > 0 {
+		// Compare against every entry so that timing doesn't tell which matched
+		valid := false
+		for _, t := range b.history {
+			if compareToken(cfg, t, clientToken) {
+				valid = true
+			}
+		}
+		return valid
+	}
+	// No client token can match one that is still pending
+	return token != "" && compareToken(cfg, token, clientToken)
+}
 
-	// Path of the CSRF cookie.
-	// Optional. Default value none.
-	CookiePath string
+// compareToken reports whether clientToken matches the expected token, using
+// HashVerify if the expected token is stored hashed.
+func compareToken(cfg Config, expected, clientToken string) bool {
+	if cfg.HashVerify != nil {
+		return cfg.HashVerify(expected, clientToken)
+	}
+	if cfg.TokenEncoding != "" {
+		return compareDecoded(cfg.TokenEncoding, expected, clientToken)
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(clientToken)) == 1
+}
 
-	// Max age (in seconds) of the CSRF cookie.
-	// Optional. Default value 86400 (24hr).
-	CookieMaxAge int
+// isBlocked reports whether Blocklist rejects clientToken, logging the
+// rejection if so.
+func isBlocked(c *fiber.Ctx, cfg Config, clientToken string) bool {
+	if cfg.Blocklist == nil || !cfg.Blocklist(clientToken) {
+		return false
+	}
+	logEvent(c, cfg, "blocklisted token rejected", map[string]interface{}{
+		"path": logPath(c, cfg),
+	})
+	return true
+}
 
-	// Indicates if CSRF cookie is secure.
-	// Optional. Default value false.
-	CookieSecure bool
+// signedTokenReason tells why checkToken rejected a well-formed signed
+// token: its signature, the method it was used with or its age.
+func signedTokenReason(cfg Config, b binding, secret, clientToken string) error {
+	if cfg.Mode == ModeHMAC && cfg.TimeBucket > 0 {
+		return ErrBadSignature
+	}
+	key := b.key
+	if cfg.Mode == ModeSplitToken {
+		key = []byte(secret)
+	}
+	switch {
+	case !verifyHMACToken(key, b.signed(), clientToken):
+		return ErrBadSignature
+	case !methodAllowed(clientToken, b.method):
+		return ErrMethodNotAllowed
+	case cfg.Mode == ModeSplitToken && tokenExpired(cfg, clientToken):
+		return ErrTokenExpired
+	}
+	return nil
+}
 
-	// Indicates if CSRF cookie is HTTP only.
-	// Optional. Default value false.
-	CookieHTTPOnly bool
+// tokenExpired reports whether a signed token is older than TokenMaxAge.
+func tokenExpired(cfg Config, token string) bool {
+	if cfg.TokenMaxAge <= 0 {
+		return false
+	}
+	issued, ok := tokenIssuedAt(token)
+	return !ok || cfg.Now().Sub(issued) > time.Duration(cfg.TokenMaxAge)*time.Second
 }
 
-// New ...
-func New(config ...Config) func(*fiber.Ctx) {
-	// Init config
-	var cfg Config
-	if len(config) > 0 {
-		cfg = config[0]
+// signedMode reports whether the tokens of the mode carry a signature.
+func signedMode(cfg Config) bool {
+	return cfg.Mode == ModeHMAC || cfg.Mode == ModeSaltedHMAC || cfg.Mode == ModeSplitToken
+}
+
+// cookieBound reports whether request tokens are checked against the CSRF
+// cookie, so that requests without it can't pass.
+func cookieBound(cfg Config) bool {
+	return !cfg.CookieDisabled && (cfg.Mode == ModeDoubleSubmit || cfg.Mode == ModeSplitToken)
+}
+
+// writeCookies sets the CSRF cookie and, in split-token mode, the token cookie.
+func writeCookies(c *fiber.Ctx, cfg Config, secret, token string) {
+	if cfg.CookieDisabled || cfg.VerifyOnly || cfg.Mode == ModeSaltedHMAC {
+		return
 	}
-	if cfg.TokenLength == 0 {
-		cfg.TokenLength = 32
+	setCookie(c, cfg, cfg.CookieName, secret, cfg.CookiePath, cfg.CookieDomain, cfg.CookieSameSite, cfg.CookieHTTPOnly, cfg.CookieMaxAge)
+	if cfg.Mode == ModeSplitToken {
+		writeTokenCookie(c, cfg, token)
 	}
-	if cfg.TokenLookup == "" {
-		cfg.TokenLookup = "header:X-CSRF-Token"
+}
+
+// writeTokenCookie sets the token cookie of ModeSplitToken.
+func writeTokenCookie(c *fiber.Ctx, cfg Config, token string) {
+	maxAge := cfg.CookieMaxAge
+	if cfg.TokenMaxAge > 0 {
+		maxAge = cfg.TokenMaxAge
 	}
-	if cfg.ContextKey == "" {
-		cfg.ContextKey = "csrf"
+	setCookie(c, cfg, cfg.TokenCookieName, token, cfg.TokenCookiePath, cfg.TokenCookieDomain, cfg.TokenCookieSameSite, cfg.TokenCookieHTTPOnly, maxAge)
+}
+
+// redactedFields lists Config fields String never renders.
+var redactedFields = map[string]bool{
+	"Secret":     true,
+	"EdgeSecret": true,
+}
+
+// String renders the config for startup logging. Secrets are redacted to
+// "***" and functions and interfaces are only reported as set or nil.
+func (cfg Config) String() string {
+	v := reflect.ValueOf(cfg)
+	t := v.Type()
+	var b strings.Builder
+	b.WriteString("csrf.Config{")
+	for i := 0; i < t.NumField(); i++ {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		name, f := t.Field(i).Name, v.Field(i)
+		b.WriteString(name)
+		b.WriteString(": ")
+		switch {
+		case redactedFields[name]:
+			if f.Len() > 0 {
+				b.WriteString("***")
+			}
+		case f.Kind() == reflect.Func || f.Kind() == reflect.Interface:
+			if f.IsNil() {
+				b.WriteString("nil")
+			} else {
+				b.WriteString("set")
+			}
+		case f.Kind() == reflect.String:
+			b.WriteString(strconv.Quote(f.String()))
+		default:
+			fmt.Fprint(&b, f.Interface())
+		}
 	}
-	if cfg.CookieName == "" {
-		cfg.CookieName = "_csrf"
+	b.WriteString("}")
+	return b.String()
+}
+
+// newExtractor returns the extractor for a comma separated list of
+// "<source>:<key>" lookups, trying sources that parse the body last and at
+// most maxAttempts sources if it is positive. The first source holding a
+// token wins unless requireAll is set, in which case every source must hold
+// the same token. Form sources resolve repeated fields with duplicates.
+func newExtractor(lookup string, requireAll bool, maxAttempts int, duplicates DuplicatePolicy) func(c *fiber.Ctx) (string, error) {
+	var cheap, costly []func(c *fiber.Ctx) (string, error)
+	for _, l := range strings.Split(lookup, ",") {
+		l = strings.TrimSpace(l)
+		if parsesBody(l) {
+			costly = append(costly, newSourceExtractor(l, duplicates))
+		} else {
+			cheap = append(cheap, newSourceExtractor(l, duplicates))
+		}
 	}
-	if cfg.CookieMaxAge == 0 {
-		cfg.CookieMaxAge = 86400
+	extractors := append(cheap, costly...)
+	if requireAll && maxAttempts > 0 && maxAttempts < len(extractors) {
+		panic("csrf: MaxSourceAttempts must cover every source with RequireAllSources")
+	}
+	if maxAttempts > 0 && maxAttempts < len(extractors) {
+		extractors = extractors[:maxAttempts]
+	}
+	if len(extractors) == 1 {
+		return extractors[0]
+	}
+	return func(c *fiber.Ctx) (string, error) {
+		token := ""
+		var missing error
+		for _, extract := range extractors {
+			t, err := extract(c)
+			if err != nil {
+				if requireAll {
+					return "", err
+				}
+				missing = err
+				continue
+			}
+			if !requireAll {
+				return t, nil
+			}
+			if token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(t)) != 1 {
+				return "", ErrSourcesDisagree
+			}
+			token = t
+		}
+		if token == "" {
+			return "", missing
+		}
+		return token, nil
+	}
+}
+
+// containsLookup reports whether lookup is one of the sources of tokenLookup.
+func containsLookup(tokenLookup, lookup string) bool {
+	for _, l := range strings.Split(tokenLookup, ",") {
+		if strings.TrimSpace(l) == lookup {
+			return true
+		}
+	}
+	return false
+}
+
+// missingTokenHandler returns the MissingTokenHandlers entry that answers a
+// request without a token, or nil if there is none.
+func missingTokenHandler(c *fiber.Ctx, cfg Config) func(*fiber.Ctx) {
+	var fallback func(*fiber.Ctx)
+	contentType := strings.ToLower(c.Get(fiber.HeaderContentType))
+	for _, lookup := range strings.Split(cfg.TokenLookup, ",") {
+		lookup = strings.TrimSpace(lookup)
+		handler, ok := cfg.MissingTokenHandlers[lookup]
+		if !ok {
+			continue
+		}
+		if !parsesBody(lookup) {
+			if fallback == nil {
+				fallback = handler
+			}
+			continue
+		}
+		if strings.HasPrefix(contentType, fiber.MIMEMultipartForm) ||
+			(strings.HasPrefix(lookup, "form:") && strings.HasPrefix(contentType, fiber.MIMEApplicationForm)) {
+			return handler
+		}
+	}
+	return fallback
+}
+
+// parsesBody reports whether a "<source>:<key>" lookup reads the body.
+func parsesBody(lookup string) bool {
+	return strings.HasPrefix(lookup, "form:") || strings.HasPrefix(lookup, "multipart:")
+}
+
+// newSourceExtractor returns the extractor for a "<source>:<key>" lookup.
+// Surrounding whitespace is trimmed, and a token holding nothing else is
+// treated as missing rather than as a mismatch.
+func newSourceExtractor(lookup string, duplicates DuplicatePolicy) func(c *fiber.Ctx) (string, error) {
+	extract := sourceExtractor(lookup, duplicates)
+	return func(c *fiber.Ctx) (string, error) {
+		token, err := extract(c)
+		if err != nil {
+			return "", err
+		}
+		if token = strings.TrimSpace(token); token == "" {
+			return "", errors.New("missing csrf token")
+		}
+		c.Locals(sourceKey, lookup)
+		return token, nil
 	}
-	parts := strings.Split(cfg.TokenLookup, ":")
-	extractor := csrfFromHeader(parts[1])
+}
+
+// sourceExtractor returns the untrimmed extractor of newSourceExtractor.
+func sourceExtractor(lookup string, duplicates DuplicatePolicy) func(c *fiber.Ctx) (string, error) {
+	parts := strings.Split(lookup, ":")
 	switch parts[0] {
 	case "form":
-		extractor = csrfFromForm(parts[1])
+		if duplicates != FirstValue {
+			return csrfFromFormValues(parts[1], duplicates)
+		}
+		return csrfFromForm(parts[1])
+	case "multipart":
+		return csrfFromFirstPart(parts[1])
 	case "query":
-		extractor = csrfFromQuery(parts[1])
+		return csrfFromQuery(parts[1])
 	case "param":
-		extractor = csrfFromParam(parts[1])
+		return csrfFromParam(parts[1])
+	case "forwarded":
+		return csrfFromForwarded(parts[1])
+	case "headerfield":
+		if len(parts) != 3 {
+			panic("csrf: TokenLookup headerfield must be \"headerfield:<header>:<field>\"")
+		}
+		return csrfFromHeaderField(parts[1], parts[2])
 	}
-	return func(c *fiber.Ctx) {
-		// Filter request to skip middleware
-		if cfg.Filter != nil && cfg.Filter(c) {
-			c.Next()
-			return
+	return csrfFromHeader(parts[1])
+}
+
+// StaticHeaderValidator returns a SkipHeaderValidator that accepts a header
+// only if its value equals values[header], compared in constant time.
+func StaticHeaderValidator(values map[string]string) func(header, value string) bool {
+	return func(header, value string) bool {
+		expected, ok := values[header]
+		return ok && subtle.ConstantTimeCompare([]byte(expected), []byte(value)) == 1
+	}
+}
+
+// skipByHeader reports whether a SkipIfHeaderPresent header applies.
+func skipByHeader(c *fiber.Ctx, cfg Config) bool {
+	for _, header := range cfg.SkipIfHeaderPresent {
+		value := c.Get(header)
+		if value == "" {
+			continue
 		}
-		key := c.Cookies(cfg.CookieName)
-		token := ""
-		if key == "" {
-			token = utils.UUID()
-		} else {
-			token = key
+		if cfg.SkipHeaderValidator == nil || cfg.SkipHeaderValidator(header, value) {
+			return true
 		}
-		switch c.Method() {
-		case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
-		default:
-			// Validate token only for requests which are not defined as 'safe' by RFC7231
-			clientToken, err := extractor(c)
-			if err != nil {
-				c.SendStatus(fiber.StatusBadRequest)
-				return
-			}
-			if subtle.ConstantTimeCompare([]byte(token), []byte(clientToken)) != 1 {
-				c.SendStatus(fiber.StatusForbidden)
-				return
+	}
+	return false
+}
+
+// readCookie returns the value of a CSRF cookie without its version marker.
+// With CookieVersion set, cookies without a known marker read as absent so
+// that they are reissued.
+func readCookie(c *fiber.Ctx, cfg Config, name string) string {
+	raw := c.Cookies(name)
+	if cfg.CookieVersion == "" {
+		return stripVersion(raw, cfg.CompatVersions)
+	}
+	if value := stripVersion(raw, tokenVersions(cfg)); value != raw {
+		return value
+	}
+	return ""
+}
+
+// tokenVersions returns the version markers stripped from tokens.
+func tokenVersions(cfg Config) []string {
+	if cfg.CookieVersion == "" {
+		return cfg.CompatVersions
+	}
+	return append([]string{cfg.CookieVersion}, cfg.CompatVersions...)
+}
+
+// setCookie writes a CSRF cookie with the attributes shared by all cookies.
+func setCookie(c *fiber.Ctx, cfg Config, name, value, path, domain, sameSite string, httpOnly bool, maxAge int) {
+	cookie := new(fiber.Cookie)
+	cookie.Name = name
+	cookie.Value = value
+	if cfg.CookieVersion != "" {
+		cookie.Value = cfg.CookieVersion + "." + value
+	}
+	cookie.Path = path
+	cookie.Domain = domain
+	cookie.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	cookie.Secure = cfg.CookieSecure || cfg.RequireSecure
+	cookie.HTTPOnly = httpOnly
+	cookie.SameSite = sameSite
+	sendCookie(c, cfg, cookie)
+}
+
+// isSafeMethod reports whether method is listed in SafeMethods or, without
+// them, defined as 'safe' by RFC7231.
+func isSafeMethod(cfg Config, method string) bool {
+	if cfg.SafeMethods != nil {
+		for _, m := range cfg.SafeMethods {
+			if strings.EqualFold(m, method) {
+				return true
 			}
 		}
-		// Set CSRF cookie
-		cookie := new(fiber.Cookie)
-		cookie.Name = cfg.CookieName
-		cookie.Value = token
-		if cfg.CookiePath != "" {
-			cookie.Path = cfg.CookiePath
+		return false
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// appendTokenToRedirect adds token as param to the Location of a redirect
+// response that stays on the request host.
+func appendTokenToRedirect(c *fiber.Ctx, param, token string) {
+	status := c.Fasthttp.Response.StatusCode()
+	if status < fiber.StatusMultipleChoices || status >= fiber.StatusBadRequest {
+		return
+	}
+	location := string(c.Fasthttp.Response.Header.Peek(fiber.HeaderLocation))
+	u, err := url.Parse(location)
+	if location == "" || err != nil || (u.Host == "" && u.Scheme != "") || (u.Host != "" && !strings.EqualFold(u.Host, c.Hostname())) {
+		return
+	}
+	q := u.Query()
+	q.Set(param, token)
+	u.RawQuery = q.Encode()
+	c.Set(fiber.HeaderLocation, u.String())
+}
+
+// originAllowed reports whether the Origin, or without it the Referer or
+// Sec-Fetch-Site header, shows that the request comes from host, or the
+// request host if host is empty.
+func originAllowed(c *fiber.Ctx, host string) bool {
+	if host == "" {
+		host = c.Hostname()
+	}
+	if origin := c.Get(fiber.HeaderOrigin); origin != "" {
+		return sameHost(origin, host)
+	}
+	if referer := c.Get(fiber.HeaderReferer); referer != "" {
+		return sameHost(referer, host)
+	}
+	return c.Get("Sec-Fetch-Site") == "same-origin"
+}
+
+// sameHost reports whether rawurl is an absolute URL on host.
+func sameHost(rawurl, host string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, host)
+}
+
+// isWebSocketHandshake reports whether the request asks for a WebSocket upgrade.
+func isWebSocketHandshake(c *fiber.Ctx) bool {
+	return c.Method() == http.MethodGet && strings.EqualFold(c.Get(fiber.HeaderUpgrade), "websocket")
+}
+
+// echoSubprotocol accepts the first requested subprotocol other than the
+// token entry, or the token entry if there is no other.
+func echoSubprotocol(c *fiber.Ctx, prefix string) {
+	accepted := ""
+	for _, protocol := range strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+		protocol = strings.TrimSpace(protocol)
+		if !strings.HasPrefix(protocol, prefix) {
+			accepted = protocol
+			break
 		}
-		if cfg.CookieDomain != "" {
-			cookie.Domain = cfg.CookieDomain
+		if accepted == "" {
+			accepted = protocol
 		}
-		cookie.Expires = time.Now().Add(time.Duration(cfg.CookieMaxAge) * time.Second)
-		cookie.Secure = cfg.CookieSecure
-		cookie.HTTPOnly = cfg.CookieHTTPOnly
-		c.Cookie(cookie)
+	}
+	if accepted != "" {
+		c.Set(fiber.HeaderSecWebSocketProtocol, accepted)
+	}
+}
 
-		// Store token in context
-		c.Locals(cfg.ContextKey, token)
+// isSecure reports whether the request was made over HTTPS. Unlike
+// c.Secure, X-Forwarded-Proto is only consulted when trustProxy is set.
+func isSecure(c *fiber.Ctx, trustProxy bool) bool {
+	if c.Fasthttp.IsTLS() {
+		return true
+	}
+	return trustProxy && strings.EqualFold(c.Get(fiber.HeaderXForwardedProto), "https")
+}
 
-		// Protect clients from caching the response
-		c.Vary(fiber.HeaderCookie)
+// appendVary merges fields into the Vary response header, skipping excluded
+// fields and fields that are already listed (case-insensitive).
+func appendVary(c *fiber.Ctx, exclude []string, fields ...string) {
+	appendHeaderList(c, fiber.HeaderVary, exclude, fields...)
+}
 
-		c.Next()
+// appendHeaderList adds fields missing from the comma separated list in the
+// response header, skipping excluded fields and lists holding "*".
+func appendHeaderList(c *fiber.Ctx, header string, exclude []string, fields ...string) {
+	current := c.Fasthttp.Response.Header.Peek(header)
+	values := strings.Split(string(current), ",")
+	if len(current) == 0 {
+		values = values[:0]
+	}
+	changed := false
+	for _, field := range fields {
+		if containsFold(exclude, field) {
+			continue
+		}
+		if containsFold(values, field) || containsFold(values, "*") {
+			continue
+		}
+		values = append(values, field)
+		changed = true
 	}
+	if !changed {
+		return
+	}
+	for i := range values {
+		values[i] = strings.TrimSpace(values[i])
+	}
+	c.Set(header, strings.Join(values, ", "))
+}
+
+// containsPath reports whether paths holds path. Unless strict is set, a
+// trailing slash is ignored on both sides, like Fiber does by default.
+func containsPath(paths []string, path string, strict bool) bool {
+	if !strict {
+		path = trimTrailingSlash(path)
+	}
+	for _, p := range paths {
+		if !strict {
+			p = trimTrailingSlash(p)
+		}
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// trimTrailingSlash removes a trailing slash from a path other than "/".
+func trimTrailingSlash(path string) string {
+	if len(path) > 1 && path[len(path)-1] == '/' {
+		return path[:len(path)-1]
+	}
+	return path
+}
+
+// containsFold reports whether list holds s, ignoring case and whitespace.
+func containsFold(list []string, s string) bool {
+	for i := range list {
+		if strings.EqualFold(strings.TrimSpace(list[i]), s) {
+			return true
+		}
+	}
+	return false
 }
 
 // csrfFromHeader returns a function that extracts token from the request header.
@@ -191,3 +2251,126 @@ func csrfFromForm(param string) func(c *fiber.Ctx) (string, error) {
 		return token, nil
 	}
 }
+
+// csrfFromFormValues returns a function that extracts token from the body
+// fields named param, resolving repeated fields with duplicates. Unlike
+// csrfFromForm, it ignores the query string.
+func csrfFromFormValues(param string, duplicates DuplicatePolicy) func(c *fiber.Ctx) (string, error) {
+	return func(c *fiber.Ctx) (string, error) {
+		var values []string
+		for _, v := range c.Fasthttp.PostArgs().PeekMulti(param) {
+			values = append(values, string(v))
+		}
+		if form, err := c.Fasthttp.MultipartForm(); err == nil {
+			values = append(values, form.Value[param]...)
+		}
+		if len(values) > 1 && duplicates == RejectDuplicates {
+			return "", ErrDuplicateToken
+		}
+		token := ""
+		if len(values) > 0 {
+			token = values[len(values)-1]
+		}
+		if token == "" {
+			return "", errors.New("missing csrf token in form parameter")
+		}
+		return token, nil
+	}
+}
+
+// csrfFromFirstPart returns a function that extracts token from the first
+// part of a multipart body, so that the token is checked without parsing the
+// rest of the upload. The request is rejected if that part isn't the token.
+//
+// The server already streams multipart bodies of known length into a parsed
+// form before any handler runs, keeping large files on disk. Part order is
+// lost by then, so for those bodies the token is read from the form and only
+// has to be a single plain field.
+func csrfFromFirstPart(param string) func(c *fiber.Ctx) (string, error) {
+	return func(c *fiber.Ctx) (string, error) {
+		missing := errors.New("missing csrf token in first multipart part")
+		boundary := string(c.Fasthttp.Request.Header.MultipartFormBoundary())
+		if boundary == "" {
+			return "", missing
+		}
+		// The raw body is empty once the server has parsed it into a form
+		body := c.Fasthttp.Request.SwapBody(nil)
+		c.Fasthttp.Request.SwapBody(body)
+		if len(body) == 0 {
+			form, err := c.Fasthttp.MultipartForm()
+			if err != nil || len(form.Value[param]) != 1 || len(form.File[param]) != 0 || form.Value[param][0] == "" {
+				return "", missing
+			}
+			return form.Value[param][0], nil
+		}
+		reader := multipart.NewReader(bytes.NewReader(body), boundary)
+		part, err := reader.NextPart()
+		if err != nil || part.FormName() != param || part.FileName() != "" {
+			return "", missing
+		}
+		token, err := ioutil.ReadAll(io.LimitReader(part, maxTokenSize))
+		if err != nil || len(token) == 0 {
+			return "", missing
+		}
+		return string(token), nil
+	}
+}
+
+// csrfFromSubprotocol returns a function that extracts token from the
+// Sec-WebSocket-Protocol entry starting with prefix.
+func csrfFromSubprotocol(prefix string) func(c *fiber.Ctx) (string, error) {
+	return func(c *fiber.Ctx) (string, error) {
+		for _, protocol := range strings.Split(c.Get(fiber.HeaderSecWebSocketProtocol), ",") {
+			protocol = strings.TrimSpace(protocol)
+			if strings.HasPrefix(protocol, prefix) && len(protocol) > len(prefix) {
+				return protocol[len(prefix):], nil
+			}
+		}
+		return "", errors.New("missing csrf token in websocket subprotocol")
+	}
+}
+
+// csrfFromForwarded returns a function that extracts token from a parameter
+// of the Forwarded header (RFC7239), for proxies that relocate custom headers.
+func csrfFromForwarded(param string) func(c *fiber.Ctx) (string, error) {
+	return func(c *fiber.Ctx) (string, error) {
+		token := headerParam(c.Get(fiber.HeaderForwarded), param)
+		if token == "" {
+			return "", errors.New("missing csrf token in forwarded header")
+		}
+		return token, nil
+	}
+}
+
+// csrfFromHeaderField returns a function that extracts token from a field of
+// a structured header value such as "nonce=abc;csrf=xyz".
+func csrfFromHeaderField(header, field string) func(c *fiber.Ctx) (string, error) {
+	return func(c *fiber.Ctx) (string, error) {
+		token := headerParam(c.Get(header), field)
+		if token == "" {
+			return "", errors.New("missing csrf token in header field")
+		}
+		return token, nil
+	}
+}
+
+// headerParam returns the value of the first name=value pair called name in
+// a header value made of comma or semicolon separated pairs.
+func headerParam(header, name string) string {
+	for _, element := range strings.Split(header, ",") {
+		for _, pair := range strings.Split(element, ";") {
+			i := strings.IndexByte(pair, '=')
+			if i < 0 || !strings.EqualFold(strings.TrimSpace(pair[:i]), name) {
+				continue
+			}
+			value := strings.TrimSpace(pair[i+1:])
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+			if value != "" {
+				return value
+			}
+		}
+	}
+	return ""
+}
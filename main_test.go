@@ -3,3 +3,3718 @@
 // 📝 Github Repository: https://github.com/gofiber/fiber
 
 package csrf
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/utils"
+)
+
+func init() {
+	// Leaked tokens fail the tests loudly instead of being redacted
+	panicOnLeak = true
+}
+
+// go test -run Test_CSRF_Vary
+func Test_CSRF_Vary(t *testing.T) {
+	testCases := []struct {
+		prior    string
+		exclude  []string
+		expected string
+	}{
+		{"", nil, "Cookie"},
+		{"Accept-Encoding", nil, "Accept-Encoding, Cookie"},
+		{"Accept-Encoding,cookie", nil, "Accept-Encoding,cookie"},
+		{"*", nil, "*"},
+		{"Accept-Encoding", []string{"cookie"}, "Accept-Encoding"},
+	}
+	for _, tc := range testCases {
+		app := fiber.New()
+		prior := tc.prior
+		app.Use(func(c *fiber.Ctx) {
+			if prior != "" {
+				c.Set(fiber.HeaderVary, prior)
+			}
+			c.Next()
+		})
+		app.Use(New(Config{VaryExclude: tc.exclude}))
+		app.Get("/", func(c *fiber.Ctx) {})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.expected, resp.Header.Get(fiber.HeaderVary), tc.prior)
+	}
+}
+
+// go test -run Test_CSRF_ProtectionHeader
+func Test_CSRF_ProtectionHeader(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		EmitProtectionHeader: true,
+		Filter: func(c *fiber.Ctx) bool {
+			return c.Path() == "/skip"
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Get("/skip", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "1", resp.Header.Get("X-CSRF-Protection"))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/skip", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Protection"))
+
+	app = fiber.New()
+	app.Use(New())
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Protection"))
+}
+
+// go test -run Test_CSRF_HMAC
+func Test_CSRF_HMAC(t *testing.T) {
+	newApp := func() *fiber.App {
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:   ModeHMAC,
+			Secret: []byte("secret"),
+			SessionKey: func(c *fiber.Ctx) string {
+				return c.Cookies("session")
+			},
+		}))
+		app.Get("/", func(c *fiber.Ctx) {})
+		app.Post("/", func(c *fiber.Ctx) {})
+		return app
+	}
+	app := newApp()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "session=alice")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+
+	post := func(app *fiber.App, session, token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+
+	// Bound to the session, no cookie needed
+	utils.AssertEqual(t, fiber.StatusOK, post(app, "alice", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(app, "bob", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(app, "alice", token+"x"))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(app, "alice", "garbage"))
+
+	// No server state: a fresh instance with the same secret accepts it
+	utils.AssertEqual(t, fiber.StatusOK, post(newApp(), "alice", token))
+}
+
+// go test -run Test_CSRF_SaltedHMAC
+func Test_CSRF_SaltedHMAC(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:   ModeSaltedHMAC,
+		Secret: []byte("secret"),
+		SessionKey: func(c *fiber.Ctx) string {
+			return c.Cookies("session")
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.SendString(c.Locals("csrf").(string))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	issue := func() string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session=alice")
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, 0, len(resp.Cookies()))
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+		return string(body)
+	}
+	post := func(session, token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+
+	// A fresh salt per request, all valid for the session
+	first, second := issue(), issue()
+	utils.AssertEqual(t, false, first == second)
+	utils.AssertEqual(t, fiber.StatusOK, post("alice", first))
+	utils.AssertEqual(t, fiber.StatusOK, post("alice", second))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("bob", first))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("alice", "garbage"))
+}
+
+// go test -run Test_CSRF_ContextKeyCollision
+func Test_CSRF_ContextKeyCollision(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		var logged []map[string]interface{}
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) {
+			c.Locals("csrf", "taken")
+			c.Next()
+		})
+		app.Use(New(Config{
+			Debug: debug,
+			Logger: func(msg string, fields map[string]interface{}) {
+				logged = append(logged, fields)
+			},
+		}))
+		app.Get("/", func(c *fiber.Ctx) {})
+
+		_, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		if debug {
+			utils.AssertEqual(t, 1, len(logged))
+			utils.AssertEqual(t, "csrf", logged[0]["key"])
+		} else {
+			utils.AssertEqual(t, 0, len(logged))
+		}
+	}
+}
+
+// go test -run Test_CSRF_Challenge
+func Test_CSRF_Challenge(t *testing.T) {
+	cfg := Config{Storage: NewMemoryStorage()}
+	app := fiber.New()
+	app.Get("/challenge", ChallengeHandler(cfg))
+	app.Post("/transfer", RequireChallenge(cfg, "transfer"), func(c *fiber.Ctx) {})
+	app.Post("/delete", RequireChallenge(cfg, "delete"), func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/challenge?action=transfer", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	var body struct {
+		Token  string `json:"token"`
+		Action string `json:"action"`
+	}
+	utils.AssertEqual(t, nil, json.NewDecoder(resp.Body).Decode(&body))
+	utils.AssertEqual(t, "transfer", body.Action)
+
+	post := func(path, token string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-CSRF-Challenge", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+
+	// Bound to its action
+	utils.AssertEqual(t, fiber.StatusForbidden, post("/delete", body.Token))
+	// Single use
+	utils.AssertEqual(t, fiber.StatusOK, post("/transfer", body.Token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("/transfer", body.Token))
+	utils.AssertEqual(t, fiber.StatusBadRequest, post("/transfer", ""))
+}
+
+// go test -run Test_CSRF_TrustProxyHeaders
+func Test_CSRF_TrustProxyHeaders(t *testing.T) {
+	for _, trust := range []bool{true, false} {
+		app := fiber.New()
+		app.Use(New(Config{RequireSecure: true, TrustProxyHeaders: trust}))
+		app.Get("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedProto, "https")
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		if trust {
+			utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+			utils.AssertEqual(t, true, resp.Cookies()[0].Secure)
+		} else {
+			utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+		}
+	}
+}
+
+// go test -run Test_CSRF_ValidateSafeMethods
+func Test_CSRF_ValidateSafeMethods(t *testing.T) {
+	app := fiber.New()
+	app.Use(New())
+	app.Get("/events", New(Config{ValidateSafeMethods: true, TokenLookup: "query:csrf"}), func(c *fiber.Ctx) {
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+	})
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	token := resp.Cookies()[0].Value
+
+	req := httptest.NewRequest("GET", "/events", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	req = httptest.NewRequest("GET", "/events?csrf="+token, nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "text/event-stream", resp.Header.Get(fiber.HeaderContentType))
+}
+
+// go test -run Test_CSRF_SplitToken
+func Test_CSRF_SplitToken(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:            ModeSplitToken,
+		CookiePath:      "/",
+		CookieHTTPOnly:  true,
+		TokenCookiePath: "/app",
+	}))
+	app.Get("/app", func(c *fiber.Ctx) {})
+	app.Post("/app", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/app", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	secret, token := cookies["_csrf"], cookies["csrf_token"]
+	utils.AssertEqual(t, "/", secret.Path)
+	utils.AssertEqual(t, true, secret.HttpOnly)
+	utils.AssertEqual(t, "/app", token.Path)
+	utils.AssertEqual(t, false, token.HttpOnly)
+	utils.AssertEqual(t, true, secret.Value != token.Value)
+
+	post := func(cookie, header string) int {
+		req := httptest.NewRequest("POST", "/app", nil)
+		req.Header.Set(fiber.HeaderCookie, cookie)
+		req.Header.Set("X-CSRF-Token", header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post("_csrf="+secret.Value, token.Value))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("_csrf="+secret.Value, secret.Value))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("csrf_token="+token.Value, token.Value))
+}
+
+// go test -run Test_CSRF_CompatVersions
+func Test_CSRF_CompatVersions(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{CompatVersions: []string{"v1"}}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		cookie, header string
+		status         int
+	}{
+		{token, token, fiber.StatusOK},
+		{"v1." + token, token, fiber.StatusOK},
+		{token, "v1." + token, fiber.StatusOK},
+		{token, "v9." + token, fiber.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+tc.cookie)
+		req.Header.Set("X-CSRF-Token", tc.header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.cookie+" "+tc.header)
+	}
+}
+
+// go test -run Test_CSRF_OnValidate_Age
+func Test_CSRF_OnValidate_Age(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	var got []Validation
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:       ModeHMAC,
+		Secret:     []byte("secret"),
+		SessionKey: func(c *fiber.Ctx) string { return "" },
+		Now:        func() time.Time { return now },
+		OnValidate: func(c *fiber.Ctx, v Validation) {
+			got = append(got, v)
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+	utils.AssertEqual(t, 0, len(got))
+
+	now = now.Add(90 * time.Second)
+	for _, header := range []string{token, "bad"} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", header)
+		_, err = app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+	}
+	utils.AssertEqual(t, []Validation{
+		{Valid: true, Age: 90 * time.Second, HasAge: true},
+		{Valid: false, Err: ErrTokenMalformed},
+	}, got)
+}
+
+// go test -run Test_CSRF_SkipIfHeaderPresent
+func Test_CSRF_SkipIfHeaderPresent(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		SkipIfHeaderPresent: []string{"X-API-Key"},
+		SkipHeaderValidator: StaticHeaderValidator(map[string]string{"X-API-Key": "s3cr3t"}),
+	}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		key     string
+		status  int
+		cookies int
+	}{
+		{"s3cr3t", fiber.StatusOK, 0},
+		{"wrong", fiber.StatusBadRequest, 0},
+		{"", fiber.StatusBadRequest, 0},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.key)
+		utils.AssertEqual(t, tc.cookies, len(resp.Cookies()), tc.key)
+	}
+}
+
+// go test -run Test_Config_String
+func Test_Config_String(t *testing.T) {
+	cfg := Config{
+		CookieName: "_csrf_admin",
+		Mode:       ModeHMAC,
+		Secret:     []byte("hunter2"),
+		SessionKey: func(c *fiber.Ctx) string { return "" },
+	}
+	s := cfg.String()
+	utils.AssertEqual(t, false, strings.Contains(s, "hunter2"))
+	utils.AssertEqual(t, true, strings.Contains(s, "Secret: ***"))
+	utils.AssertEqual(t, true, strings.Contains(s, `CookieName: "_csrf_admin"`))
+	utils.AssertEqual(t, true, strings.Contains(s, "SessionKey: set"))
+	utils.AssertEqual(t, true, strings.Contains(s, "Filter: nil"))
+	utils.AssertEqual(t, s, fmt.Sprint(cfg))
+
+	utils.AssertEqual(t, true, strings.Contains(Config{}.String(), "Secret: ,"))
+}
+
+// go test -run Test_CSRF_FromForwarded
+func Test_CSRF_FromForwarded(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{TokenLookup: "forwarded:csrf"}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		forwarded string
+		status    int
+	}{
+		{"for=192.0.2.60;proto=https;csrf=" + token, fiber.StatusOK},
+		{`for=192.0.2.43, for="[2001:db8::1]";CSRF="` + token + `"`, fiber.StatusOK},
+		{"for=192.0.2.60;proto=https", fiber.StatusBadRequest},
+		{"csrf=wrong", fiber.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set(fiber.HeaderForwarded, tc.forwarded)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.forwarded)
+	}
+}
+
+// go test -run Test_CSRF_RefreshHandler
+func Test_CSRF_RefreshHandler(t *testing.T) {
+	app := fiber.New()
+	app.Post("/csrf/refresh", RefreshHandler(Config{}))
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	refresh := func(header string) *http.Response {
+		req := httptest.NewRequest("POST", "/csrf/refresh", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+
+	resp := refresh(token)
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	var body struct {
+		Token string `json:"token"`
+	}
+	utils.AssertEqual(t, nil, json.NewDecoder(resp.Body).Decode(&body))
+	utils.AssertEqual(t, true, body.Token != token)
+	utils.AssertEqual(t, body.Token, resp.Cookies()[0].Value)
+
+	resp = refresh("wrong")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, 0, len(resp.Cookies()))
+}
+
+// go test -run Test_CSRF_RefreshHandler_RejectedStoresNothing
+func Test_CSRF_RefreshHandler_RejectedStoresNothing(t *testing.T) {
+	storage := &countingStorage{Storage: NewMemoryStorage()}
+	filter := &setFilter{tokens: map[string]bool{}, all: true}
+	app := fiber.New()
+	app.Post("/csrf/refresh", RefreshHandler(Config{
+		Mode:         ModeSynchronizer,
+		Storage:      storage,
+		SessionKey:   func(c *fiber.Ctx) string { return c.Get("X-Session") },
+		IssuedFilter: filter,
+	}))
+
+	refresh := func(session, token string) int {
+		req := httptest.NewRequest("POST", "/csrf/refresh", nil)
+		req.Header.Set("X-Session", session)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	// The session has no token yet, so none can match
+	utils.AssertEqual(t, fiber.StatusForbidden, refresh("alice", "guess"))
+	utils.AssertEqual(t, 0, storage.tokenSets)
+	utils.AssertEqual(t, 0, len(filter.tokens))
+
+	utils.AssertEqual(t, nil, storage.Storage.Set("token:"+SHA256KeyHash("bob"), []byte("bob-token"), 0))
+	utils.AssertEqual(t, fiber.StatusForbidden, refresh("bob", "wrong"))
+	utils.AssertEqual(t, 0, storage.tokenSets)
+	utils.AssertEqual(t, fiber.StatusOK, refresh("bob", "bob-token"))
+	utils.AssertEqual(t, 1, storage.tokenSets)
+}
+
+// go test -run Test_CSRF_Synchronizer_CookieDisabled
+func Test_CSRF_Synchronizer_CookieDisabled(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:           ModeSynchronizer,
+		Storage:        NewMemoryStorage(),
+		SessionKey:     func(c *fiber.Ctx) string { return c.Cookies("session") },
+		CookieDisabled: true,
+		TokenLookup:    "form:_csrf",
+	}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.Send(c.Locals("csrf"))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "session=alice")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, 0, len(resp.Cookies()))
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	token := string(body)
+	utils.AssertEqual(t, 36, len(token))
+
+	post := func(session, token string) int {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("_csrf="+token))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post("alice", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("bob", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("alice", "wrong"))
+}
+
+// go test -run Test_CSRF_CookieDisabled_CookieBound
+func Test_CSRF_CookieDisabled_CookieBound(t *testing.T) {
+	for _, cfg := range []Config{
+		{CookieDisabled: true},
+		{Mode: ModeSplitToken, CookieDisabled: true},
+	} {
+		func() {
+			defer func() {
+				utils.AssertEqual(t, "csrf: CookieDisabled requires a mode that doesn't validate against the cookie", recover())
+			}()
+			New(cfg)
+		}()
+	}
+	// The expected token comes from elsewhere
+	New(Config{CookieDisabled: true, ExpectedTokenKey: "session_csrf"})
+}
+
+// go test -run Test_CSRF_FromHeaderField
+func Test_CSRF_FromHeaderField(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{TokenLookup: "headerfield:X-Security:csrf"}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		header string
+		status int
+	}{
+		{"nonce=abc;csrf=" + token, fiber.StatusOK},
+		{"nonce=abc, csrf=" + token, fiber.StatusOK},
+		{"nonce=abc", fiber.StatusBadRequest},
+		{"", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-Security", tc.header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.header)
+	}
+}
+
+// go test -run Test_CSRF_DebugToken
+func Test_CSRF_DebugToken(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		app := fiber.New()
+		app.Use(func(c *fiber.Ctx) {
+			c.Locals("csrf_debug_token", "forced")
+			c.Next()
+		})
+		app.Use(New(Config{Debug: debug, Logger: func(string, map[string]interface{}) {}}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", "forced")
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		if debug {
+			utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+			utils.AssertEqual(t, "forced", resp.Cookies()[0].Value)
+		} else {
+			utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+		}
+	}
+}
+
+// go test -run Test_CSRF_KeyFunc
+func Test_CSRF_KeyFunc(t *testing.T) {
+	keys := map[string][]byte{"acme": []byte("acme-key"), "globex": []byte("globex-key")}
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:       ModeHMAC,
+		SessionKey: func(c *fiber.Ctx) string { return "session" },
+		KeyFunc: func(c *fiber.Ctx) ([]byte, error) {
+			key, ok := keys[c.Get("X-Tenant")]
+			if !ok {
+				return nil, errors.New("kms unavailable")
+			}
+			return key, nil
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Tenant", "acme")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+
+	post := func(tenant string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-Tenant", tenant)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post("acme"))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("globex"))
+	utils.AssertEqual(t, fiber.StatusServiceUnavailable, post("initech"))
+}
+
+// go test -run Test_CSRF_SignedLink
+func Test_CSRF_SignedLink(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	cfg := Config{Secret: []byte("secret"), Now: func() time.Time { return now }}
+	app := fiber.New()
+	app.Get("/unsubscribe", RequireSignedLink(cfg), func(c *fiber.Ctx) {})
+	app.Post("/unsubscribe", RequireSignedLink(cfg), func(c *fiber.Ctx) {})
+
+	link, err := SignLink(cfg, "/unsubscribe", time.Hour)
+	utils.AssertEqual(t, nil, err)
+
+	status := func(method, target string) int {
+		resp, err := app.Test(httptest.NewRequest(method, target, nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, status("GET", link))
+	utils.AssertEqual(t, fiber.StatusOK, status("POST", link))
+
+	tampered := strings.Replace(link, "exp=", "exp=9", 1)
+	utils.AssertEqual(t, fiber.StatusForbidden, status("POST", tampered))
+	utils.AssertEqual(t, fiber.StatusBadRequest, status("POST", "/unsubscribe"))
+
+	now = now.Add(2 * time.Hour)
+	utils.AssertEqual(t, fiber.StatusForbidden, status("POST", link))
+}
+
+// go test -run Test_CSRF_StorageCookieMismatch
+func Test_CSRF_StorageCookieMismatch(t *testing.T) {
+	testCases := []struct {
+		policy MismatchPolicy
+		header string
+		status int
+		logged int
+	}{
+		{TrustStorage, "stored", fiber.StatusOK, 1},
+		{TrustStorage, "cookie", fiber.StatusForbidden, 1},
+		{TrustCookie, "cookie", fiber.StatusOK, 0},
+		{TrustCookie, "stored", fiber.StatusForbidden, 0},
+		{RejectMismatch, "stored", fiber.StatusForbidden, 0},
+	}
+	for _, tc := range testCases {
+		storage := NewMemoryStorage()
+		utils.AssertEqual(t, nil, storage.Set("token:"+SHA256KeyHash("alice"), []byte("stored"), 0))
+		logged := 0
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:                    ModeSynchronizer,
+			Storage:                 storage,
+			SessionKey:              func(c *fiber.Ctx) string { return "alice" },
+			OnStorageCookieMismatch: tc.policy,
+			Logger: func(string, map[string]interface{}) {
+				logged++
+			},
+		}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf=cookie")
+		req.Header.Set("X-CSRF-Token", tc.header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode)
+		utils.AssertEqual(t, tc.logged, logged)
+	}
+}
+
+// go test -run Test_CSRF_CompressToken
+func Test_CSRF_CompressToken(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:          ModeHMAC,
+		Secret:        []byte("secret"),
+		SessionKey:    func(c *fiber.Ctx) string { return "alice" },
+		CompressToken: true,
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+	utils.AssertEqual(t, "~", token[:1])
+
+	plain, ok := decompressToken(token)
+	utils.AssertEqual(t, true, ok)
+	for _, header := range []string{token, plain} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", header)
+		resp, err = app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+		// The cookie keeps its compressed form
+		utils.AssertEqual(t, token, resp.Cookies()[0].Value)
+	}
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-CSRF-Token", "~"+token[2:])
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_WebSocket
+func Test_CSRF_WebSocket(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{ValidateWebSocket: true}))
+	app.Get("/ws", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		protocol, echoed string
+		status           int
+	}{
+		{"chat, csrf." + token, "chat", fiber.StatusOK},
+		{"csrf." + token, "csrf." + token, fiber.StatusOK},
+		{"chat, csrf.wrong", "", fiber.StatusForbidden},
+		{"chat", "", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", "/ws", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set(fiber.HeaderUpgrade, "websocket")
+		req.Header.Set(fiber.HeaderSecWebSocketProtocol, tc.protocol)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.protocol)
+		utils.AssertEqual(t, tc.echoed, resp.Header.Get(fiber.HeaderSecWebSocketProtocol), tc.protocol)
+	}
+
+	// Plain GETs are unaffected
+	resp, err := app.Test(httptest.NewRequest("GET", "/ws", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_SafeMethodErrorStatus
+func Test_CSRF_SafeMethodErrorStatus(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{ValidateSafeMethods: true, SafeMethodErrorStatus: fiber.StatusUnprocessableEntity}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		method, header string
+		status         int
+	}{
+		{"GET", "malformed", fiber.StatusUnprocessableEntity},
+		{"GET", "", fiber.StatusUnprocessableEntity},
+		{"POST", "malformed", fiber.StatusForbidden},
+		{"POST", "", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf=6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+		if tc.header != "" {
+			req.Header.Set("X-CSRF-Token", tc.header)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.method+" "+tc.header)
+	}
+}
+
+// go test -run Test_CSRF_IssuanceRateLimit
+func Test_CSRF_IssuanceRateLimit(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{IssuanceRateLimit: 2}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	get := func(cookie string) *http.Response {
+		req := httptest.NewRequest("GET", "/", nil)
+		if cookie != "" {
+			req.Header.Set(fiber.HeaderCookie, "_csrf="+cookie)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+	resp := get("")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	token := resp.Cookies()[0].Value
+	utils.AssertEqual(t, fiber.StatusOK, get("").StatusCode)
+	utils.AssertEqual(t, fiber.StatusTooManyRequests, get("").StatusCode)
+	utils.AssertEqual(t, fiber.StatusTooManyRequests, get("").StatusCode)
+	utils.AssertEqual(t, fiber.StatusOK, get(token).StatusCode)
+}
+
+// go test -run Test_CSRF_IssuanceRateLimit_InvalidCookie
+func Test_CSRF_IssuanceRateLimit_InvalidCookie(t *testing.T) {
+	session := func(c *fiber.Ctx) string { return "alice" }
+	for _, cfg := range []Config{
+		{Mode: ModeHMAC, Secret: []byte("secret"), SessionKey: session, IssuanceRateLimit: 2},
+		{Mode: ModeSplitToken, IssuanceRateLimit: 2},
+	} {
+		app := fiber.New()
+		app.Use(New(cfg))
+		app.Get("/", func(c *fiber.Ctx) {})
+
+		get := func(cookie string) *http.Response {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(fiber.HeaderCookie, cookie)
+			resp, err := app.Test(req)
+			utils.AssertEqual(t, nil, err, "app.Test(req)")
+			return resp
+		}
+		resp := get("")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+		var cookies []string
+		for _, cookie := range resp.Cookies() {
+			cookies = append(cookies, cookie.Name+"="+cookie.Value)
+		}
+		valid := strings.Join(cookies, "; ")
+
+		// Cookies that fail verification get a fresh token, which counts
+		utils.AssertEqual(t, fiber.StatusOK, get("_csrf=garbage; csrf_token=garbage").StatusCode)
+		utils.AssertEqual(t, fiber.StatusTooManyRequests, get("_csrf=garbage; csrf_token=garbage").StatusCode)
+		utils.AssertEqual(t, fiber.StatusOK, get(valid).StatusCode)
+	}
+}
+
+// go test -run Test_CSRF_IssuanceRateLimit_NothingStored
+func Test_CSRF_IssuanceRateLimit_NothingStored(t *testing.T) {
+	storage := &countingStorage{Storage: NewMemoryStorage()}
+	filter := &setFilter{tokens: map[string]bool{}}
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:              ModeSynchronizer,
+		Storage:           storage,
+		SessionKey:        func(c *fiber.Ctx) string { return c.Get("X-Session") },
+		IssuanceRateLimit: 1,
+		IssuedFilter:      filter,
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	statuses := map[int]int{}
+	for _, session := range []string{"a", "b", "c", "d", "e"} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("X-Session", session)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		statuses[resp.StatusCode]++
+	}
+	utils.AssertEqual(t, 1, statuses[fiber.StatusOK])
+	utils.AssertEqual(t, 4, statuses[fiber.StatusTooManyRequests])
+	// Throttled requests neither mint nor store a token
+	utils.AssertEqual(t, 1, storage.tokenSets)
+	utils.AssertEqual(t, 1, len(filter.tokens))
+}
+
+// countingStorage counts the tokens written to Storage, leaving out the
+// IssuanceRateLimit counters.
+type countingStorage struct {
+	Storage
+	tokenSets int
+}
+
+func (s *countingStorage) Set(key string, val []byte, exp time.Duration) error {
+	if strings.HasPrefix(key, "token:") {
+		s.tokenSets++
+	}
+	return s.Storage.Set(key, val, exp)
+}
+
+// go test -run Test_CSRF_ValidatorWithSubject
+func Test_CSRF_ValidatorWithSubject(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		ValidatorWithSubject: func(c *fiber.Ctx, clientToken string) (string, bool, error) {
+			switch clientToken {
+			case "alice-token":
+				return "alice", true, nil
+			case "broken":
+				return "", false, errors.New("token service down")
+			}
+			return "", false, nil
+		},
+	}))
+	app.Post("/", func(c *fiber.Ctx) {
+		c.Send(c.Locals("csrf_subject"))
+	})
+
+	testCases := []struct {
+		header, body string
+		status       int
+	}{
+		{"alice-token", "alice", fiber.StatusOK},
+		{"bob-token", "", fiber.StatusForbidden},
+		{"broken", "", fiber.StatusInternalServerError},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", tc.header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.header)
+		if tc.status == fiber.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			utils.AssertEqual(t, tc.body, string(body))
+		}
+	}
+}
+
+// go test -run Test_CSRF_MultiSource
+func Test_CSRF_MultiSource(t *testing.T) {
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		requireAll    bool
+		header, query string
+		status        int
+	}{
+		{false, token, "", fiber.StatusOK},
+		{false, "", token, fiber.StatusOK},
+		{false, "", "", fiber.StatusBadRequest},
+		{true, token, token, fiber.StatusOK},
+		{true, token, "", fiber.StatusBadRequest},
+		{true, "", token, fiber.StatusBadRequest},
+		{true, token, "other", fiber.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		app := fiber.New()
+		app.Use(New(Config{TokenLookup: "header:X-CSRF-Token, query:csrf", RequireAllSources: tc.requireAll}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("POST", "/?csrf="+tc.query, nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		if tc.header != "" {
+			req.Header.Set("X-CSRF-Token", tc.header)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+}
+
+// go test -run Test_CSRF_SourceOrder
+func Test_CSRF_SourceOrder(t *testing.T) {
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		maxAttempts int
+		header      string
+		status      int
+	}{
+		// The header is tried before the form, whose token is wrong
+		{0, token, fiber.StatusOK},
+		{0, "", fiber.StatusForbidden},
+		// The form is never reached
+		{1, "", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		app := fiber.New()
+		app.Use(New(Config{TokenLookup: "form:_csrf,header:X-CSRF-Token", MaxSourceAttempts: tc.maxAttempts}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader("_csrf=wrong"))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		if tc.header != "" {
+			req.Header.Set("X-CSRF-Token", tc.header)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+
+	defer func() {
+		utils.AssertEqual(t, "csrf: MaxSourceAttempts must cover every source with RequireAllSources", recover())
+	}()
+	New(Config{TokenLookup: "header:X-CSRF-Token,query:csrf", RequireAllSources: true, MaxSourceAttempts: 1})
+}
+
+// go test -run Test_CSRF_Generator
+func Test_CSRF_Generator(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{Generator: ULIDGenerator}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, 26, len(resp.Cookies()[0].Value))
+}
+
+// go test -run Test_CSRF_ExpectedTokenKey
+func Test_CSRF_ExpectedTokenKey(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) {
+		if c.Get("X-Session") != "" {
+			c.Locals("session_csrf", "from-session")
+		}
+		c.Next()
+	})
+	app.Use(New(Config{ExpectedTokenKey: "session_csrf"}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		session bool
+		header  string
+		status  int
+	}{
+		{true, "from-session", fiber.StatusOK},
+		{true, "from-cookie", fiber.StatusForbidden},
+		{false, "from-cookie", fiber.StatusOK},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf=from-cookie")
+		req.Header.Set("X-CSRF-Token", tc.header)
+		if tc.session {
+			req.Header.Set("X-Session", "1")
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.header)
+	}
+}
+
+// go test -run Test_CSRF_MetadataHandler
+func Test_CSRF_MetadataHandler(t *testing.T) {
+	cfg := Config{CookieName: "_csrf_spa", TokenLookup: "header:X-XSRF-Token,form:_csrf"}
+	app := fiber.New()
+	app.Get("/csrf", New(cfg), MetadataHandler(cfg))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/csrf", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	var meta Metadata
+	utils.AssertEqual(t, nil, json.NewDecoder(resp.Body).Decode(&meta))
+	utils.AssertEqual(t, Metadata{
+		Token:      resp.Cookies()[0].Value,
+		HeaderName: "X-XSRF-Token",
+		FormField:  "_csrf",
+		CookieName: "_csrf_spa",
+	}, meta)
+}
+
+// go test -run Test_CSRF_TrustSameOriginFetch
+func Test_CSRF_TrustSameOriginFetch(t *testing.T) {
+	testCases := []struct {
+		trust  bool
+		site   string
+		status int
+	}{
+		{true, "same-origin", fiber.StatusOK},
+		{true, "same-site", fiber.StatusBadRequest},
+		{true, "cross-site", fiber.StatusBadRequest},
+		{true, "", fiber.StatusBadRequest},
+		{false, "same-origin", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		app := fiber.New()
+		app.Use(New(Config{TrustSameOriginFetch: tc.trust}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("POST", "/", nil)
+		if tc.site != "" {
+			req.Header.Set("Sec-Fetch-Site", tc.site)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.site)
+	}
+}
+
+// go test -run Test_CSRF_TrustXRequestedWith
+func Test_CSRF_TrustXRequestedWith(t *testing.T) {
+	var reason string
+	app := fiber.New()
+	app.Use(New(Config{TrustXRequestedWith: true}))
+	app.Post("/", func(c *fiber.Ctx) {
+		reason = SkipReason(c)
+	})
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderXRequestedWith, "XMLHttpRequest")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, ReasonXRequestedWith, reason)
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("name=gopher"))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusBadRequest, resp.StatusCode)
+
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderXRequestedWith, "Fetch")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusBadRequest, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_CookieVersion
+func Test_CSRF_CookieVersion(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{CookieVersion: "v2"}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.Send(c.Locals("csrf"))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	request := func(method, cookie, header string) *http.Response {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+cookie)
+		req.Header.Set("X-CSRF-Token", header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+
+	// Known version
+	resp := request("GET", "v2."+token, "")
+	utils.AssertEqual(t, "v2."+token, resp.Cookies()[0].Value)
+	body, _ := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, token, string(body))
+	utils.AssertEqual(t, fiber.StatusOK, request("POST", "v2."+token, token).StatusCode)
+	utils.AssertEqual(t, fiber.StatusOK, request("POST", "v2."+token, "v2."+token).StatusCode)
+
+	// Unknown version is reissued
+	resp = request("GET", "v3."+token, "")
+	utils.AssertEqual(t, true, resp.Cookies()[0].Value != "v3."+token)
+	utils.AssertEqual(t, "v2.", resp.Cookies()[0].Value[:3])
+	utils.AssertEqual(t, fiber.StatusForbidden, request("POST", "v3."+token, token).StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, request("POST", token, token).StatusCode)
+}
+
+// go test -run Test_CSRF_MultipartFirstPart
+func Test_CSRF_MultipartFirstPart(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{TokenLookup: "multipart:_csrf"}))
+	app.Post("/", func(c *fiber.Ctx) {
+		file, err := c.FormFile("upload")
+		utils.AssertEqual(t, nil, err, "c.FormFile()")
+		c.SendString(fmt.Sprint(file.Size))
+	})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	upload := bytes.Repeat([]byte("x"), 1<<20)
+	testCases := []struct {
+		chunked    bool
+		tokenFirst bool
+		token      string
+		status     int
+	}{
+		{true, true, token, fiber.StatusOK},
+		{true, true, "wrong", fiber.StatusForbidden},
+		{true, false, token, fiber.StatusBadRequest},
+		// Bodies of known length reach the middleware already parsed
+		{false, true, token, fiber.StatusOK},
+		{false, true, "wrong", fiber.StatusForbidden},
+		{false, false, token, fiber.StatusOK},
+	}
+	for _, tc := range testCases {
+		body := &bytes.Buffer{}
+		w := multipart.NewWriter(body)
+		if tc.tokenFirst {
+			utils.AssertEqual(t, nil, w.WriteField("_csrf", tc.token))
+		}
+		part, err := w.CreateFormFile("upload", "large.bin")
+		utils.AssertEqual(t, nil, err, "w.CreateFormFile()")
+		_, err = part.Write(upload)
+		utils.AssertEqual(t, nil, err, "part.Write()")
+		if !tc.tokenFirst {
+			utils.AssertEqual(t, nil, w.WriteField("_csrf", tc.token))
+		}
+		utils.AssertEqual(t, nil, w.Close())
+
+		req := httptest.NewRequest("POST", "/", body)
+		if tc.chunked {
+			req.ContentLength = -1
+			req.TransferEncoding = []string{"chunked"}
+		}
+		req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc.chunked, tc.tokenFirst, tc.token))
+		if tc.status == fiber.StatusOK {
+			size, _ := ioutil.ReadAll(resp.Body)
+			utils.AssertEqual(t, fmt.Sprint(len(upload)), string(size))
+		}
+	}
+}
+
+// go test -run Test_CSRF_CheckOrigin
+func Test_CSRF_CheckOrigin(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{CheckOrigin: true}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		origin  string
+		referer string
+		site    string
+		status  int
+	}{
+		{"http://example.com", "", "", fiber.StatusOK},
+		{"http://evil.com", "", "", fiber.StatusForbidden},
+		{"http://evil.com", "http://example.com/form", "same-origin", fiber.StatusForbidden},
+		{"null", "", "", fiber.StatusForbidden},
+		{"", "http://example.com/form", "", fiber.StatusOK},
+		{"", "http://evil.com/form", "", fiber.StatusForbidden},
+		{"", "http://evil.com/form", "same-origin", fiber.StatusForbidden},
+		{"", "", "same-origin", fiber.StatusOK},
+		{"", "", "cross-site", fiber.StatusForbidden},
+		{"", "", "", fiber.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", token)
+		if tc.origin != "" {
+			req.Header.Set(fiber.HeaderOrigin, tc.origin)
+		}
+		if tc.referer != "" {
+			req.Header.Set(fiber.HeaderReferer, tc.referer)
+		}
+		if tc.site != "" {
+			req.Header.Set("Sec-Fetch-Site", tc.site)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc.origin, tc.referer, tc.site))
+	}
+
+	// Safe methods aren't checked
+	app.Get("/", func(c *fiber.Ctx) {})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderOrigin, "http://evil.com")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_StorageKeyHash
+func Test_CSRF_StorageKeyHash(t *testing.T) {
+	testCases := []struct {
+		hash func(string) string
+		key  string
+	}{
+		{nil, "token:" + SHA256KeyHash("alice")},
+		{func(s string) string { return "h(" + s + ")" }, "token:h(alice)"},
+	}
+	for _, tc := range testCases {
+		storage := NewMemoryStorage()
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:           ModeSynchronizer,
+			Storage:        storage,
+			StorageKeyHash: tc.hash,
+			SessionKey:     func(c *fiber.Ctx) string { return c.Cookies("session") },
+			CookieDisabled: true,
+		}))
+		app.Get("/", func(c *fiber.Ctx) {
+			c.Send(c.Locals("csrf"))
+		})
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session=alice")
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+
+		stored, err := storage.Get(tc.key)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, string(body), string(stored))
+		stored, err = storage.Get("token:alice")
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, true, stored == nil)
+
+		req = httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session=alice")
+		req.Header.Set("X-CSRF-Token", string(body))
+		resp, err = app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	}
+}
+
+// go test -run Test_CSRF_RequireQueryToken
+func Test_CSRF_RequireQueryToken(t *testing.T) {
+	app := fiber.New()
+	app.Use(New())
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Get("/unsubscribe", RequireQueryToken(Config{}, "csrf"), func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		target string
+		status int
+	}{
+		{"/", fiber.StatusOK},
+		{"/?csrf=wrong", fiber.StatusOK},
+		{"/unsubscribe?csrf=" + token, fiber.StatusOK},
+		{"/unsubscribe?csrf=wrong", fiber.StatusForbidden},
+		{"/unsubscribe", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.target)
+	}
+}
+
+// go test -run Test_CSRF_SkipReason
+func Test_CSRF_SkipReason(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		ExemptPaths:         []string{"/webhook"},
+		SkipIfHeaderPresent: []string{"X-Internal"},
+		Filter: func(c *fiber.Ctx) bool {
+			return c.Path() == "/filtered"
+		},
+	}))
+	handler := func(c *fiber.Ctx) {
+		c.SendString(SkipReason(c))
+	}
+	app.Get("/", handler)
+	app.Get("/filtered", handler)
+	app.Post("/", handler)
+	app.Post("/webhook", handler)
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		method string
+		target string
+		header string
+		reason string
+	}{
+		{"GET", "/", "", ReasonSafeMethod},
+		{"GET", "/filtered", "", ReasonFiltered},
+		{"POST", "/webhook", "", ReasonExemptPath},
+		{"POST", "/", "X-Internal", ReasonSkipHeader},
+		{"POST", "/", "X-CSRF-Token", ReasonValidated},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		if tc.header != "" {
+			req.Header.Set(tc.header, token)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode, tc.reason)
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, tc.reason, string(body))
+	}
+}
+
+// go test -run Test_CSRF_EnforceTokenLength_Generators
+func Test_CSRF_EnforceTokenLength_Generators(t *testing.T) {
+	for _, cfg := range []Config{
+		{EnforceTokenLength: true},
+		{EnforceTokenLength: true, Alphabet: "abcdefghijklmnopqrstuvwxyz", TokenLength: 40},
+		{EnforceTokenLength: true, Mode: ModeSynchronizer, Storage: NewMemoryStorage(), SessionKey: func(c *fiber.Ctx) string { return "alice" }},
+	} {
+		app := fiber.New()
+		app.Use(New(cfg))
+		app.Get("/", func(c *fiber.Ctx) {})
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		token := resp.Cookies()[0].Value
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err = app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	}
+
+	for msg, cfg := range map[string]Config{
+		"csrf: EnforceTokenLength requires ModeDoubleSubmit or ModeSynchronizer": {EnforceTokenLength: true, Mode: ModeSplitToken},
+		"csrf: EnforceTokenLength with UUIDGenerator requires TokenLength 36":    {EnforceTokenLength: true, TokenLength: 32},
+	} {
+		func() {
+			defer func() {
+				utils.AssertEqual(t, msg, recover())
+			}()
+			New(cfg)
+		}()
+	}
+}
+
+// go test -run Test_CSRF_EnforceTokenLength
+func Test_CSRF_EnforceTokenLength(t *testing.T) {
+	token := strings.Repeat("a", 32)
+	compared := 0
+	var got []Validation
+	app := fiber.New()
+	app.Use(New(Config{
+		EnforceTokenLength: true,
+		ValidatorWithSubject: func(c *fiber.Ctx, clientToken string) (string, bool, error) {
+			compared++
+			return "", clientToken == token, nil
+		},
+		OnValidate: func(c *fiber.Ctx, v Validation) {
+			got = append(got, v)
+		},
+	}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		header   string
+		status   int
+		compared int
+		err      error
+	}{
+		{token, fiber.StatusOK, 1, nil},
+		{strings.Repeat("b", 32), fiber.StatusForbidden, 1, nil},
+		{strings.Repeat("a", 31), fiber.StatusForbidden, 0, ErrTokenLength},
+		{strings.Repeat("a", 1024), fiber.StatusForbidden, 0, ErrTokenLength},
+	}
+	for _, tc := range testCases {
+		compared, got = 0, nil
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", tc.header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode)
+		utils.AssertEqual(t, tc.compared, compared)
+		utils.AssertEqual(t, 1, len(got))
+		utils.AssertEqual(t, tc.err, got[0].Err)
+	}
+}
+
+// go test -run Test_CSRF_TimeBucket
+func Test_CSRF_TimeBucket(t *testing.T) {
+	now := time.Unix(1600000050, 0)
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:       ModeHMAC,
+		Secret:     []byte("secret"),
+		SessionKey: func(c *fiber.Ctx) string { return c.Cookies("session") },
+		TimeBucket: time.Minute,
+		Now:        func() time.Time { return now },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.Send(c.Locals("csrf"))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	request := func(method, session, token string) *http.Response {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+	body, err := ioutil.ReadAll(request("GET", "alice", "").Body)
+	utils.AssertEqual(t, nil, err)
+	token := string(body)
+
+	// Stateless: the same bucket yields the same token
+	body, err = ioutil.ReadAll(request("GET", "alice", "").Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, token, string(body))
+
+	utils.AssertEqual(t, fiber.StatusOK, request("POST", "alice", token).StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, request("POST", "bob", token).StatusCode)
+
+	// Next bucket still accepts the previous one
+	now = now.Add(50 * time.Second)
+	utils.AssertEqual(t, fiber.StatusOK, request("POST", "alice", token).StatusCode)
+	body, err = ioutil.ReadAll(request("GET", "alice", "").Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, token != string(body))
+
+	// Two buckets later the token is stale
+	now = now.Add(time.Minute)
+	utils.AssertEqual(t, fiber.StatusForbidden, request("POST", "alice", token).StatusCode)
+	utils.AssertEqual(t, fiber.StatusOK, request("POST", "alice", string(body)).StatusCode)
+}
+
+// go test -run Test_CSRF_AppendTokenToRedirect
+func Test_CSRF_AppendTokenToRedirect(t *testing.T) {
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		location string
+		status   int
+		expected string
+	}{
+		{"/next", fiber.StatusFound, "/next?csrf=" + token},
+		{"/next?a=1", fiber.StatusSeeOther, "/next?a=1&csrf=" + token},
+		{"http://example.com/next", fiber.StatusFound, "http://example.com/next?csrf=" + token},
+		{"https://evil.com/next", fiber.StatusFound, "https://evil.com/next"},
+		{"//evil.com/next", fiber.StatusFound, "//evil.com/next"},
+		{"mailto:a@example.com", fiber.StatusFound, "mailto:a@example.com"},
+		{"/next", fiber.StatusCreated, "/next"},
+	}
+	for _, tc := range testCases {
+		app := fiber.New()
+		app.Use(New(Config{AppendTokenToRedirect: true}))
+		location, status := tc.location, tc.status
+		app.Get("/", func(c *fiber.Ctx) {
+			c.Location(location)
+			c.Status(status)
+		})
+
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.expected, resp.Header.Get(fiber.HeaderLocation), tc.location)
+	}
+}
+
+// go test -run Test_CSRF_FromForm_Chunked
+func Test_CSRF_FromForm_Chunked(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{TokenLookup: "form:_csrf"}))
+	app.Post("/", func(c *fiber.Ctx) {
+		c.SendString(fmt.Sprint(len(c.FormValue("data"))))
+	})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	data := strings.Repeat("x", 1<<20)
+	for _, tc := range []struct {
+		field  string
+		status int
+	}{
+		{"&_csrf=" + token, fiber.StatusOK},
+		{"&_csrf=wrong", fiber.StatusForbidden},
+		{"", fiber.StatusBadRequest},
+	} {
+		req := httptest.NewRequest("POST", "/", strings.NewReader("a=1&data="+data+tc.field))
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.field)
+		if tc.status == fiber.StatusOK {
+			body, _ := ioutil.ReadAll(resp.Body)
+			utils.AssertEqual(t, fmt.Sprint(len(data)), string(body))
+		}
+	}
+}
+
+// go test -run Test_CSRF_ShouldIssueCookie
+func Test_CSRF_ShouldIssueCookie(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		ShouldIssueCookie: func(c *fiber.Ctx) bool {
+			return c.Fasthttp.Response.StatusCode() != fiber.StatusNoContent
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Get("/empty", func(c *fiber.Ctx) {
+		c.Status(fiber.StatusNoContent)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, 1, len(resp.Cookies()))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/empty", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusNoContent, resp.StatusCode)
+	utils.AssertEqual(t, 0, len(resp.Cookies()))
+}
+
+// go test -run Test_CSRF_HistorySize
+func Test_CSRF_HistorySize(t *testing.T) {
+	storage := NewMemoryStorage()
+	cfg := Config{
+		Mode:           ModeSynchronizer,
+		Storage:        storage,
+		SessionKey:     func(c *fiber.Ctx) string { return "alice" },
+		CookieDisabled: true,
+		HistorySize:    2,
+	}
+	app := fiber.New()
+	app.Post("/refresh", RefreshHandler(cfg))
+	app.Use(New(cfg))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.Send(c.Locals("csrf"))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	tokens := []string{string(body)}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/refresh", nil)
+		req.Header.Set("X-CSRF-Token", tokens[len(tokens)-1])
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+		var refreshed struct{ Token string }
+		utils.AssertEqual(t, nil, json.NewDecoder(resp.Body).Decode(&refreshed))
+		tokens = append(tokens, refreshed.Token)
+	}
+
+	stored, err := storage.Get("token:" + SHA256KeyHash("alice"))
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, tokens[2]+" "+tokens[1], string(stored))
+
+	for i, status := range []int{fiber.StatusForbidden, fiber.StatusOK, fiber.StatusOK} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", tokens[i])
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, status, resp.StatusCode, fmt.Sprint(i))
+	}
+}
+
+// go test -run Test_CSRF_HandleOptions
+func Test_CSRF_HandleOptions(t *testing.T) {
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) {
+		// An earlier CORS middleware which lets preflights through
+		c.Set(fiber.HeaderAccessControlAllowOrigin, "https://app.example.com")
+		c.Set(fiber.HeaderAccessControlAllowHeaders, "Content-Type")
+		c.Next()
+	})
+	app.Use(New(Config{HandleOptions: true}))
+	app.Options("/", func(c *fiber.Ctx) {
+		t.Fatal("OPTIONS reached the handler")
+	})
+
+	req := httptest.NewRequest("OPTIONS", "/", nil)
+	req.Header.Set(fiber.HeaderOrigin, "https://app.example.com")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusNoContent, resp.StatusCode)
+	utils.AssertEqual(t, 1, len(resp.Cookies()))
+	utils.AssertEqual(t, resp.Cookies()[0].Value, resp.Header.Get("X-CSRF-Token"))
+	utils.AssertEqual(t, "https://app.example.com", resp.Header.Get(fiber.HeaderAccessControlAllowOrigin))
+	utils.AssertEqual(t, "Content-Type, X-CSRF-Token", resp.Header.Get(fiber.HeaderAccessControlAllowHeaders))
+	utils.AssertEqual(t, "X-CSRF-Token", resp.Header.Get(fiber.HeaderAccessControlExposeHeaders))
+
+	// Disabled by default
+	app = fiber.New()
+	app.Use(New())
+	app.Options("/", func(c *fiber.Ctx) {
+		c.SendStatus(fiber.StatusOK)
+	})
+	resp, err = app.Test(httptest.NewRequest("OPTIONS", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Token"))
+}
+
+// go test -run Test_CSRF_RetryStatus_NotCookieBound
+func Test_CSRF_RetryStatus_NotCookieBound(t *testing.T) {
+	session := func(c *fiber.Ctx) string { return "alice" }
+	for _, cfg := range []Config{
+		{Mode: ModeHMAC, Secret: []byte("secret"), SessionKey: session},
+		{Mode: ModeSaltedHMAC, Secret: []byte("secret"), SessionKey: session},
+		{Mode: ModeSynchronizer, Storage: NewMemoryStorage(), SessionKey: session},
+	} {
+		cfg.RetryStatus = fiber.StatusConflict
+		app := fiber.New()
+		app.Use(New(cfg))
+		app.Get("/", func(c *fiber.Ctx) {
+			c.Send(c.Locals("csrf"))
+		})
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+
+		// These modes validate without the cookie, so there's nothing to retry
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", string(body))
+		resp, err = app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+		utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Retry"))
+	}
+}
+
+// go test -run Test_CSRF_RetryStatus
+func Test_CSRF_RetryStatus(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{RetryStatus: fiber.StatusPreconditionRequired}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-CSRF-Token", "6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusPreconditionRequired, resp.StatusCode)
+	utils.AssertEqual(t, "1", resp.Header.Get("X-CSRF-Retry"))
+	utils.AssertEqual(t, 1, len(resp.Cookies()))
+	token := resp.Cookies()[0].Value
+
+	// The retry with the issued token passes
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-CSRF-Token", token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Retry"))
+
+	// A wrong token with an established cookie is still rejected
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-CSRF-Token", "wrong")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_HashVerify
+func Test_CSRF_HashVerify(t *testing.T) {
+	// A bcrypt-style "$alg$salt$digest" hash
+	hash := func(salt, token string) string {
+		return "$sha256$" + salt + "$" + SHA256KeyHash(salt+token)
+	}
+	verify := func(hashed, client string) bool {
+		parts := strings.Split(hashed, "$")
+		return len(parts) == 4 && hash(parts[2], client) == hashed
+	}
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+
+	storage := NewMemoryStorage()
+	utils.AssertEqual(t, nil, storage.Set("token:"+SHA256KeyHash("alice"), []byte(hash("s1", token)), 0))
+	synchronizer := fiber.New()
+	synchronizer.Use(New(Config{
+		Mode:           ModeSynchronizer,
+		Storage:        storage,
+		SessionKey:     func(c *fiber.Ctx) string { return "alice" },
+		CookieDisabled: true,
+		HashVerify:     verify,
+		HashToken:      func(token string) string { return hash("s3", token) },
+	}))
+	synchronizer.Post("/", func(c *fiber.Ctx) {})
+
+	expected := fiber.New()
+	expected.Use(func(c *fiber.Ctx) {
+		c.Locals("session_csrf", hash("s2", token))
+		c.Next()
+	})
+	expected.Use(New(Config{ExpectedTokenKey: "session_csrf", HashVerify: verify}))
+	expected.Post("/", func(c *fiber.Ctx) {})
+
+	for _, app := range []*fiber.App{synchronizer, expected} {
+		for _, tc := range []struct {
+			header string
+			status int
+		}{
+			{token, fiber.StatusOK},
+			{"wrong", fiber.StatusForbidden},
+			{hash("s1", token), fiber.StatusForbidden},
+		} {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("X-CSRF-Token", tc.header)
+			resp, err := app.Test(req)
+			utils.AssertEqual(t, nil, err, "app.Test(req)")
+			utils.AssertEqual(t, tc.status, resp.StatusCode, tc.header)
+		}
+	}
+}
+
+// go test -run Test_CSRF_HashToken
+func Test_CSRF_HashToken(t *testing.T) {
+	hash := func(token string) string { return "$sha256$" + SHA256KeyHash(token) }
+	verify := func(hashed, client string) bool { return hash(client) == hashed }
+	storage := NewMemoryStorage()
+	for _, cookieDisabled := range []bool{false, true} {
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:           ModeSynchronizer,
+			Storage:        storage,
+			SessionKey:     func(c *fiber.Ctx) string { return fmt.Sprint(cookieDisabled) },
+			CookieDisabled: cookieDisabled,
+			HashVerify:     verify,
+			HashToken:      hash,
+		}))
+		app.Get("/", func(c *fiber.Ctx) {
+			c.SendString(c.Locals("csrf").(string))
+		})
+		app.Post("/", func(c *fiber.Ctx) {
+			c.SendString(c.Locals("csrf").(string))
+		})
+
+		send := func(method, cookie, token string) (int, string) {
+			req := httptest.NewRequest(method, "/", nil)
+			if cookie != "" {
+				req.Header.Set(fiber.HeaderCookie, "_csrf="+cookie)
+			}
+			req.Header.Set("X-CSRF-Token", token)
+			resp, err := app.Test(req)
+			utils.AssertEqual(t, nil, err, "app.Test(req)")
+			body, err := ioutil.ReadAll(resp.Body)
+			utils.AssertEqual(t, nil, err)
+			return resp.StatusCode, string(body)
+		}
+		_, token := send("GET", "", "")
+		stored, err := storage.Get("token:" + SHA256KeyHash(fmt.Sprint(cookieDisabled)))
+		utils.AssertEqual(t, nil, err)
+		// Storage only sees the hash, clients only the plaintext
+		utils.AssertEqual(t, hash(token), string(stored))
+		cookie := ""
+		if !cookieDisabled {
+			cookie = token
+			_, reused := send("GET", cookie, "")
+			utils.AssertEqual(t, token, reused)
+		}
+		status, body := send("POST", cookie, token)
+		utils.AssertEqual(t, fiber.StatusOK, status)
+		utils.AssertEqual(t, token, body)
+		status, _ = send("POST", cookie, hash(token))
+		utils.AssertEqual(t, fiber.StatusForbidden, status)
+	}
+
+	for _, cfg := range []Config{
+		{HashVerify: verify},
+		{Mode: ModeSynchronizer, Storage: storage, SessionKey: func(c *fiber.Ctx) string { return "" }, HashVerify: verify},
+		{Mode: ModeSynchronizer, Storage: storage, SessionKey: func(c *fiber.Ctx) string { return "" }, HashToken: hash},
+	} {
+		func() {
+			defer func() { utils.AssertEqual(t, true, recover() != nil) }()
+			New(cfg)
+		}()
+	}
+}
+
+// go test -run Test_CSRF_MethodOverrideHeader
+func Test_CSRF_MethodOverrideHeader(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{MethodOverrideHeader: "X-HTTP-Method-Override"}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		method   string
+		override string
+		status   int
+	}{
+		{"GET", "", fiber.StatusOK},
+		{"GET", "delete", fiber.StatusBadRequest},
+		{"POST", "DELETE", fiber.StatusBadRequest},
+		{"POST", "GET", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		if tc.override != "" {
+			req.Header.Set("X-HTTP-Method-Override", tc.override)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.method+" "+tc.override)
+	}
+
+	// A valid token passes the tunneled DELETE
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-HTTP-Method-Override", "DELETE")
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-CSRF-Token", token)
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_CacheablePaths
+func Test_CSRF_CacheablePaths(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{CacheablePaths: []string{"/shell"}}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Get("/shell", func(c *fiber.Ctx) {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/shell", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderVary))
+	utils.AssertEqual(t, "public, max-age=300", resp.Header.Get(fiber.HeaderCacheControl))
+	// The cached response must not carry a visitor's cookie
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "Cookie", resp.Header.Get(fiber.HeaderVary))
+	utils.AssertEqual(t, 1, len(resp.Cookies()))
+}
+
+// go test -run Test_CSRF_ExemptPaths_TrailingSlash
+func Test_CSRF_ExemptPaths_TrailingSlash(t *testing.T) {
+	testCases := []struct {
+		strict bool
+		exempt string
+		path   string
+		status int
+	}{
+		{false, "/webhook", "/webhook", fiber.StatusOK},
+		{false, "/webhook", "/webhook/", fiber.StatusOK},
+		{false, "/webhook/", "/webhook", fiber.StatusOK},
+		{false, "/webhook", "/webhooks", fiber.StatusBadRequest},
+		{true, "/webhook", "/webhook", fiber.StatusOK},
+		{true, "/webhook", "/webhook/", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		app := fiber.New(&fiber.Settings{StrictRouting: tc.strict})
+		app.Use(New(Config{ExemptPaths: []string{tc.exempt}, StrictPaths: tc.strict}))
+		app.Post(tc.path, func(c *fiber.Ctx) {})
+
+		resp, err := app.Test(httptest.NewRequest("POST", tc.path, nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.exempt+" "+tc.path)
+	}
+}
+
+// go test -run Test_CSRF_PreValidate
+func Test_CSRF_PreValidate(t *testing.T) {
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	app := fiber.New()
+	app.Use(New(Config{
+		PreValidate: func(c *fiber.Ctx) error {
+			if c.Get("X-Too-Large") != "" {
+				return fiber.NewError(fiber.StatusRequestEntityTooLarge, "too large")
+			}
+			// Runs before extraction, so the token set here is seen
+			c.Fasthttp.Request.Header.Set("X-CSRF-Token", token)
+			return nil
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {
+		c.SendString("handled")
+	})
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-Too-Large", "1")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusRequestEntityTooLarge, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "too large", string(body))
+
+	// Safe requests aren't validated, so the hook doesn't run
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Too-Large", "1")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_IssuanceRateLimit_RetryAfter
+func Test_CSRF_IssuanceRateLimit_RetryAfter(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	app := fiber.New()
+	app.Use(New(Config{
+		IssuanceRateLimit:  1,
+		IssuanceRateWindow: time.Minute,
+		Now:                func() time.Time { return now },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderRetryAfter))
+
+	for _, tc := range []struct {
+		elapsed time.Duration
+		retry   string
+	}{
+		{20 * time.Second, "40"},
+		{39500 * time.Millisecond, "1"},
+	} {
+		now = now.Add(tc.elapsed)
+		resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusTooManyRequests, resp.StatusCode)
+		utils.AssertEqual(t, tc.retry, resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+}
+
+// go test -run Test_CSRF_Challenge_Scoped
+func Test_CSRF_Challenge_Scoped(t *testing.T) {
+	// Without ScopedStorage, RequireChallenge falls back to Get and Delete
+	type plainStorage struct{ Storage }
+	for _, storage := range []Storage{NewMemoryStorage(), plainStorage{NewMemoryStorage()}} {
+		cfg := Config{
+			Storage:    storage,
+			SessionKey: func(c *fiber.Ctx) string { return "alice" },
+		}
+		app := fiber.New()
+		app.Get("/challenge", ChallengeHandler(cfg))
+		app.Post("/a", RequireChallenge(cfg, "a"), func(c *fiber.Ctx) {})
+		app.Post("/b", RequireChallenge(cfg, "b"), func(c *fiber.Ctx) {})
+
+		tokens := map[string]string{}
+		for _, scope := range []string{"a", "b"} {
+			resp, err := app.Test(httptest.NewRequest("GET", "/challenge?action="+scope, nil))
+			utils.AssertEqual(t, nil, err, "app.Test(req)")
+			var body struct{ Token string }
+			utils.AssertEqual(t, nil, json.NewDecoder(resp.Body).Decode(&body))
+			tokens[scope] = body.Token
+		}
+		post := func(path, token string) int {
+			req := httptest.NewRequest("POST", path, nil)
+			req.Header.Set("X-CSRF-Challenge", token)
+			resp, err := app.Test(req)
+			utils.AssertEqual(t, nil, err, "app.Test(req)")
+			return resp.StatusCode
+		}
+		utils.AssertEqual(t, fiber.StatusOK, post("/a", tokens["a"]))
+		utils.AssertEqual(t, fiber.StatusForbidden, post("/a", tokens["a"]))
+		utils.AssertEqual(t, fiber.StatusForbidden, post("/a", tokens["b"]))
+		utils.AssertEqual(t, fiber.StatusOK, post("/b", tokens["b"]))
+	}
+}
+
+// go test -run Test_CSRF_Delete
+func Test_CSRF_Delete(t *testing.T) {
+	for _, clear := range []bool{false, true} {
+		storage := NewMemoryStorage()
+		cfg := Config{
+			Mode:                  ModeSynchronizer,
+			Storage:               storage,
+			SessionKey:            func(c *fiber.Ctx) string { return "alice" },
+			ClearSiteDataOnDelete: clear,
+		}
+		app := fiber.New()
+		app.Post("/logout", func(c *fiber.Ctx) {
+			utils.AssertEqual(t, nil, Delete(c, cfg))
+		})
+		app.Use(New(cfg))
+		app.Get("/", func(c *fiber.Ctx) {})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, 1, len(resp.Cookies()))
+		stored, _ := storage.Get("token:" + SHA256KeyHash("alice"))
+		utils.AssertEqual(t, true, stored != nil)
+
+		resp, err = app.Test(httptest.NewRequest("POST", "/logout", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, 1, len(resp.Cookies()))
+		utils.AssertEqual(t, "_csrf", resp.Cookies()[0].Name)
+		utils.AssertEqual(t, "", resp.Cookies()[0].Value)
+		utils.AssertEqual(t, true, resp.Cookies()[0].Expires.Before(time.Now()))
+		stored, _ = storage.Get("token:" + SHA256KeyHash("alice"))
+		utils.AssertEqual(t, true, stored == nil)
+		if clear {
+			utils.AssertEqual(t, `"cookies"`, resp.Header.Get("Clear-Site-Data"))
+		} else {
+			utils.AssertEqual(t, "", resp.Header.Get("Clear-Site-Data"))
+		}
+	}
+}
+
+// go test -run Test_CSRF_EdgeToken
+func Test_CSRF_EdgeToken(t *testing.T) {
+	secret := []byte("edge-secret")
+	app := fiber.New()
+	app.Use(New(Config{EdgeTokenHeader: "X-Edge-CSRF", EdgeSecret: secret}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.Send(c.Locals("csrf"))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	edge := "edge-issued-token"
+	request := func(method, header, token string) *http.Response {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("X-Edge-CSRF", header)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+
+	resp := request("GET", SignEdgeToken(secret, edge), "")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, edge, resp.Cookies()[0].Value)
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, edge, string(body))
+
+	utils.AssertEqual(t, fiber.StatusOK, request("POST", SignEdgeToken(secret, edge), edge).StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, request("POST", SignEdgeToken(secret, edge), "other").StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, request("POST", SignEdgeToken([]byte("forged"), edge), edge).StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, request("GET", edge, "").StatusCode)
+}
+
+// go test -run Test_CSRF_CookieRequired
+func Test_CSRF_CookieRequired(t *testing.T) {
+	var got []Validation
+	app := fiber.New()
+	app.Use(New(Config{
+		CookieRequiredStatus: fiber.StatusPreconditionFailed,
+		OnValidate: func(c *fiber.Ctx, v Validation) {
+			got = append(got, v)
+		},
+	}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		cookie string
+		status int
+		err    error
+	}{
+		{"", fiber.StatusPreconditionFailed, ErrCookieRequired},
+		{token, fiber.StatusOK, nil},
+		{"other", fiber.StatusForbidden, nil},
+	}
+	for _, tc := range testCases {
+		got = nil
+		req := httptest.NewRequest("POST", "/", nil)
+		if tc.cookie != "" {
+			req.Header.Set(fiber.HeaderCookie, "_csrf="+tc.cookie)
+		}
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.cookie)
+		utils.AssertEqual(t, 1, len(got))
+		utils.AssertEqual(t, tc.err, got[0].Err)
+	}
+}
+
+// go test -run Test_CSRF_DebugTiming
+func Test_CSRF_DebugTiming(t *testing.T) {
+	for _, debug := range []bool{true, false} {
+		var timings []map[string]interface{}
+		app := fiber.New()
+		app.Use(New(Config{
+			Debug: debug,
+			Logger: func(msg string, fields map[string]interface{}) {
+				if msg == "timing" {
+					timings = append(timings, fields)
+				}
+			},
+		}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+
+		if !debug {
+			utils.AssertEqual(t, 0, len(timings))
+			continue
+		}
+		utils.AssertEqual(t, 1, len(timings))
+		utils.AssertEqual(t, "/", timings[0]["path"])
+		for _, stage := range []string{"storage", "extract", "compare"} {
+			_, ok := timings[0][stage].(time.Duration)
+			utils.AssertEqual(t, true, ok, stage)
+		}
+	}
+}
+
+// go test -run Test_CSRF_FromContext
+func Test_CSRF_FromContext(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{ContextKey: "token"}))
+	app.Get("/", func(c *fiber.Ctx) {
+		token, ok := FromContext(c)
+		utils.AssertEqual(t, true, ok)
+		utils.AssertEqual(t, c.Locals("token"), token)
+		c.SendString(token)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, resp.Cookies()[0].Value, string(body))
+
+	// Without the middleware
+	other := fiber.New()
+	other.Get("/", func(c *fiber.Ctx) {
+		_, ok := FromContext(c)
+		utils.AssertEqual(t, false, ok)
+	})
+	_, err = other.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+}
+
+// go test -run Test_CSRF_NoCookieOnFailure
+func Test_CSRF_NoCookieOnFailure(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{CookieMaxAge: 3600}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	for _, clientToken := range []string{"", "wrong"} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		if clientToken != "" {
+			req.Header.Set("X-CSRF-Token", clientToken)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, true, resp.StatusCode >= 400)
+		// Failures leave the existing cookie and its lifetime untouched
+		utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+	}
+}
+
+// go test -run Test_CSRF_IsMutating
+func Test_CSRF_IsMutating(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		IsMutating: func(c *fiber.Ctx) bool {
+			return strings.Contains(c.Body(), "mutation")
+		},
+	}))
+	app.Post("/graphql", func(c *fiber.Ctx) {
+		// The resolver still sees the whole body
+		c.Send(c.Body())
+	})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		body, token string
+		status      int
+	}{
+		{`{"query":"{ viewer { name } }"}`, "", fiber.StatusOK},
+		{`{"query":"mutation { logout }"}`, "", fiber.StatusBadRequest},
+		{`{"query":"mutation { logout }"}`, token, fiber.StatusOK},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/graphql", strings.NewReader(tc.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		if tc.token != "" {
+			req.Header.Set("X-CSRF-Token", tc.token)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.body)
+		if resp.StatusCode == fiber.StatusOK {
+			body, err := ioutil.ReadAll(resp.Body)
+			utils.AssertEqual(t, nil, err)
+			utils.AssertEqual(t, tc.body, string(body))
+		}
+	}
+}
+
+// go test -run Test_CSRF_DuplicateTokenFields
+func Test_CSRF_DuplicateTokenFields(t *testing.T) {
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		policy DuplicatePolicy
+		body   string
+		status int
+	}{
+		{FirstValue, "_csrf=" + token + "&_csrf=wrong", fiber.StatusOK},
+		{FirstValue, "_csrf=wrong&_csrf=" + token, fiber.StatusForbidden},
+		{LastValue, "_csrf=wrong&_csrf=" + token, fiber.StatusOK},
+		{LastValue, "_csrf=" + token + "&_csrf=wrong", fiber.StatusForbidden},
+		{RejectDuplicates, "_csrf=" + token + "&_csrf=" + token, fiber.StatusForbidden},
+		{RejectDuplicates, "_csrf=" + token, fiber.StatusOK},
+		{RejectDuplicates, "", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		app := fiber.New()
+		app.Use(New(Config{TokenLookup: "form:_csrf", DuplicateTokenFields: tc.policy}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		req := httptest.NewRequest("POST", "/", strings.NewReader(tc.body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+
+	// Multipart bodies follow the same policy
+	for _, tc := range []struct {
+		policy DuplicatePolicy
+		status int
+	}{
+		{LastValue, fiber.StatusOK},
+		{RejectDuplicates, fiber.StatusForbidden},
+	} {
+		app := fiber.New()
+		app.Use(New(Config{TokenLookup: "form:_csrf", DuplicateTokenFields: tc.policy}))
+		app.Post("/", func(c *fiber.Ctx) {})
+
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		utils.AssertEqual(t, nil, w.WriteField("_csrf", "wrong"))
+		utils.AssertEqual(t, nil, w.WriteField("_csrf", token))
+		utils.AssertEqual(t, nil, w.Close())
+
+		req := httptest.NewRequest("POST", "/", &body)
+		req.Header.Set(fiber.HeaderContentType, w.FormDataContentType())
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+}
+
+// go test -run Test_CSRF_FingerprintHeaders
+func Test_CSRF_FingerprintHeaders(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:               ModeHMAC,
+		Secret:             []byte("secret"),
+		SessionKey:         func(c *fiber.Ctx) string { return "alice" },
+		FingerprintHeaders: []string{fiber.HeaderUserAgent, fiber.HeaderAcceptLanguage},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	send := func(method, ua, accept, token string) *http.Response {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set(fiber.HeaderUserAgent, ua)
+		req.Header.Set(fiber.HeaderAcceptLanguage, "en")
+		req.Header.Set(fiber.HeaderAccept, accept)
+		if token != "" {
+			req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+			req.Header.Set("X-CSRF-Token", token)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+	token := send("GET", "browser/1", "text/html", "").Cookies()[0].Value
+
+	// Unrelated headers may change, fingerprinted ones may not
+	utils.AssertEqual(t, fiber.StatusOK, send("POST", "browser/1", "application/json", token).StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, send("POST", "browser/2", "text/html", token).StatusCode)
+
+	defer func() {
+		utils.AssertEqual(t, "csrf: FingerprintHeaders requires ModeHMAC, ModeSaltedHMAC or ModeSplitToken", recover())
+	}()
+	New(Config{FingerprintHeaders: []string{fiber.HeaderUserAgent}})
+}
+
+// go test -run Test_CSRF_StaleSignedCookie
+func Test_CSRF_StaleSignedCookie(t *testing.T) {
+	session := "bob"
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:       ModeHMAC,
+		Secret:     []byte("secret"),
+		SessionKey: func(c *fiber.Ctx) string { return session },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	stale := resp.Cookies()[0].Value
+	session = "alice"
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+
+	// The cookie of the previous session yields to the valid header token
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+stale)
+	req.Header.Set("X-CSRF-Token", token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, false, resp.Cookies()[0].Value == stale)
+
+	// A header token of the previous session doesn't pass
+	req = httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-CSRF-Token", stale)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+}
+
+// go test -run Test_CSRF_DeriveSessionKeys
+func Test_CSRF_DeriveSessionKeys(t *testing.T) {
+	newApp := func(derive bool) *fiber.App {
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:              ModeHMAC,
+			Secret:            []byte("secret"),
+			SessionKey:        func(c *fiber.Ctx) string { return c.Cookies("session") },
+			DeriveSessionKeys: derive,
+		}))
+		app.Get("/", func(c *fiber.Ctx) {})
+		app.Post("/", func(c *fiber.Ctx) {})
+		return app
+	}
+	issue := func(app *fiber.App, session string) string {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.Cookies()[0].Value
+	}
+	post := func(app *fiber.App, session, token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+
+	derived, plain := newApp(true), newApp(false)
+	token := issue(derived, "alice")
+	utils.AssertEqual(t, fiber.StatusOK, post(derived, "alice", token))
+	utils.AssertEqual(t, fiber.StatusOK, post(newApp(true), "alice", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(derived, "bob", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(plain, "alice", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(derived, "alice", issue(plain, "alice")))
+}
+
+// go test -run Test_CSRF_Blocklist
+func Test_CSRF_Blocklist(t *testing.T) {
+	leaked := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	var logged []string
+	var got []Validation
+	app := fiber.New()
+	app.Use(New(Config{
+		Blocklist: func(token string) bool { return token == leaked },
+		Logger: func(msg string, fields map[string]interface{}) {
+			logged = append(logged, msg)
+		},
+		OnValidate: func(c *fiber.Ctx, v Validation) { got = append(got, v) },
+	}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	for _, tc := range []struct {
+		token  string
+		status int
+	}{
+		{leaked, fiber.StatusForbidden},
+		{"9f2c8a4e-1b7d-4c3e-8f6a-2d5b7e9c1a3f", fiber.StatusOK},
+	} {
+		// The cookie matches, so only the blocklist can reject it
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+tc.token)
+		req.Header.Set("X-CSRF-Token", tc.token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode)
+	}
+	utils.AssertEqual(t, []string{"blocklisted token rejected"}, logged)
+	utils.AssertEqual(t, ErrTokenBlocked, got[0].Err)
+	utils.AssertEqual(t, true, got[1].Valid)
+}
+
+// go test -run Test_CSRF_ValidatorCache
+func Test_CSRF_ValidatorCache(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	calls := 0
+	app := fiber.New()
+	app.Use(New(Config{
+		ValidatorWithSubject: func(c *fiber.Ctx, clientToken string) (string, bool, error) {
+			calls++
+			return "alice", clientToken == "remote-token", nil
+		},
+		ValidatorCacheTTL: 30 * time.Second,
+		Now:               func() time.Time { return now },
+	}))
+	app.Post("/", func(c *fiber.Ctx) {
+		c.SendString(c.Locals("csrf_subject").(string))
+	})
+
+	post := func(token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	for i := 0; i < 3; i++ {
+		utils.AssertEqual(t, fiber.StatusOK, post("remote-token"))
+		utils.AssertEqual(t, fiber.StatusForbidden, post("other"))
+	}
+	utils.AssertEqual(t, 2, calls)
+
+	// Expired results are validated again
+	now = now.Add(time.Minute)
+	utils.AssertEqual(t, fiber.StatusOK, post("remote-token"))
+	utils.AssertEqual(t, 3, calls)
+}
+
+// go test -run Test_CSRF_AllowedMethods
+func Test_CSRF_AllowedMethods(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:           ModeSaltedHMAC,
+		Secret:         []byte("secret"),
+		SessionKey:     func(c *fiber.Ctx) string { return "alice" },
+		AllowedMethods: func(c *fiber.Ctx) []string { return []string{"post"} },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.SendString(c.Locals("csrf").(string))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+	app.Delete("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	token := string(body)
+	utils.AssertEqual(t, true, strings.Contains(token, ":POST."))
+
+	send := func(method, token string) int {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, send("POST", token))
+	utils.AssertEqual(t, fiber.StatusForbidden, send("DELETE", token))
+	// The methods are signed
+	utils.AssertEqual(t, fiber.StatusForbidden, send("DELETE", strings.Replace(token, ":POST.", ":DELETE.", 1)))
+}
+
+// go test -run Test_CSRF_AllowedMethods_Override
+func Test_CSRF_AllowedMethods_Override(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:                 ModeSaltedHMAC,
+		Secret:               []byte("secret"),
+		SessionKey:           func(c *fiber.Ctx) string { return "alice" },
+		AllowedMethods:       func(c *fiber.Ctx) []string { return []string{c.Query("for", "POST")} },
+		MethodOverrideHeader: "X-HTTP-Method-Override",
+	}))
+	app.Get("/", func(c *fiber.Ctx) {
+		c.SendString(c.Locals("csrf").(string))
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	issue := func(method string) string {
+		resp, err := app.Test(httptest.NewRequest("GET", "/?for="+method, nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+		return string(body)
+	}
+	send := func(override, token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("X-HTTP-Method-Override", override)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	post, del := issue("POST"), issue("DELETE")
+	utils.AssertEqual(t, fiber.StatusOK, send("", post))
+	// The tunneled method is the one the token must allow
+	utils.AssertEqual(t, fiber.StatusForbidden, send("DELETE", post))
+	utils.AssertEqual(t, fiber.StatusOK, send("delete", del))
+	utils.AssertEqual(t, fiber.StatusForbidden, send("", del))
+}
+
+// go test -run Test_CSRF_RejectionReasons
+func Test_CSRF_RejectionReasons(t *testing.T) {
+	now := time.Now()
+	var reason error
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:           ModeSplitToken,
+		TokenMaxAge:    60,
+		AllowedMethods: func(c *fiber.Ctx) []string { return []string{"POST"} },
+		Now:            func() time.Time { return now },
+		OnValidate:     func(c *fiber.Ctx, v Validation) { reason = v.Err },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+	app.Delete("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	cookies := map[string]string{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	send := func(method, token string) int {
+		reason = nil
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+cookies["_csrf"])
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	token := cookies["csrf_token"]
+	utils.AssertEqual(t, fiber.StatusOK, send("POST", token))
+	utils.AssertEqual(t, nil, reason)
+
+	utils.AssertEqual(t, fiber.StatusForbidden, send("DELETE", token))
+	utils.AssertEqual(t, ErrMethodNotAllowed, reason)
+
+	utils.AssertEqual(t, fiber.StatusForbidden, send("POST", strings.Replace(token, ":POST.", ":DELETE.", 1)))
+	utils.AssertEqual(t, ErrBadSignature, reason)
+
+	now = now.Add(2 * time.Minute)
+	utils.AssertEqual(t, fiber.StatusForbidden, send("POST", token))
+	utils.AssertEqual(t, ErrTokenExpired, reason)
+}
+
+// go test -run Test_CSRF_EarlyTokenHeader
+func Test_CSRF_EarlyTokenHeader(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{EarlyTokenHeader: "X-CSRF-Token", CacheablePaths: []string{"/shell"}}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Get("/shell", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, resp.Cookies()[0].Value, resp.Header.Get("X-CSRF-Token"))
+	utils.AssertEqual(t, "Cookie", resp.Header.Get(fiber.HeaderVary))
+
+	// Not on shared cached pages
+	resp, err = app.Test(httptest.NewRequest("GET", "/shell", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Token"))
+
+	// Nor on unsafe requests
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	req.Header.Set("X-CSRF-Token", token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get("X-CSRF-Token"))
+}
+
+// go test -run Test_CSRF_SplitTokenCookieAttributes
+func Test_CSRF_SplitTokenCookieAttributes(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:                ModeSplitToken,
+		CookiePath:          "/",
+		CookieHTTPOnly:      true,
+		CookieSameSite:      "Strict",
+		TokenCookiePath:     "/app",
+		TokenCookieSameSite: "Lax",
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	secret, token := cookies["_csrf"], cookies["csrf_token"]
+	utils.AssertEqual(t, true, secret.HttpOnly)
+	utils.AssertEqual(t, "/", secret.Path)
+	utils.AssertEqual(t, http.SameSiteStrictMode, secret.SameSite)
+	utils.AssertEqual(t, false, token.HttpOnly)
+	utils.AssertEqual(t, "/app", token.Path)
+	utils.AssertEqual(t, http.SameSiteLaxMode, token.SameSite)
+
+	// The token cookie follows CookieSameSite unless set
+	cfg := configDefault(Config{Mode: ModeSplitToken, CookieSameSite: "None"})
+	utils.AssertEqual(t, "None", cfg.TokenCookieSameSite)
+}
+
+// go test -run Test_CSRF_CanonicalHost
+func Test_CSRF_CanonicalHost(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{CheckOrigin: true, CanonicalHost: "app.example.com"}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	testCases := []struct {
+		host, origin string
+		status       int
+	}{
+		{"ingress-a.internal", "https://app.example.com", fiber.StatusOK},
+		{"ingress-b.internal", "https://app.example.com", fiber.StatusOK},
+		{"ingress-a.internal", "https://ingress-a.internal", fiber.StatusForbidden},
+		{"app.example.com", "https://evil.com", fiber.StatusForbidden},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "http://"+tc.host+"/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", token)
+		req.Header.Set(fiber.HeaderOrigin, tc.origin)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+}
+
+// go test -run Test_CSRF_BodyToken
+func Test_CSRF_BodyToken(t *testing.T) {
+	cfg := Config{Secret: []byte("secret"), SessionKey: func(c *fiber.Ctx) string { return c.Cookies("session") }}
+	payload := `{"to":"bob","amount":100}`
+	app := fiber.New()
+	app.Get("/confirm", func(c *fiber.Ctx) {
+		token, err := SignBody(c, cfg, []byte(payload))
+		utils.AssertEqual(t, nil, err)
+		c.SendString(token)
+	})
+	app.Post("/transfer", RequireBodyToken(cfg, 64), func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("GET", "/confirm", nil)
+	req.Header.Set(fiber.HeaderCookie, "session=alice")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	token := string(body)
+
+	post := func(session, body, token string) int {
+		req := httptest.NewRequest("POST", "/transfer", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set(fiber.HeaderCookie, "session="+session)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post("alice", payload, token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("alice", `{"to":"eve","amount":100}`, token))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("bob", payload, token))
+	utils.AssertEqual(t, fiber.StatusBadRequest, post("alice", payload, ""))
+	utils.AssertEqual(t, fiber.StatusRequestEntityTooLarge, post("alice", strings.Repeat("x", 65), token))
+}
+
+// go test -run Test_CSRF_BodyToken_KeyAndExpiry
+func Test_CSRF_BodyToken_KeyAndExpiry(t *testing.T) {
+	now := time.Now()
+	cfg := Config{
+		KeyFunc:           func(c *fiber.Ctx) ([]byte, error) { return []byte("tenant-" + c.Get("X-Tenant")), nil },
+		SessionKey:        func(c *fiber.Ctx) string { return "alice" },
+		DeriveSessionKeys: true,
+		TokenMaxAge:       60,
+		Now:               func() time.Time { return now },
+	}
+	payload := `{"to":"bob","amount":100}`
+	app := fiber.New()
+	app.Get("/confirm", func(c *fiber.Ctx) {
+		token, err := SignBody(c, cfg, []byte(payload))
+		utils.AssertEqual(t, nil, err)
+		c.SendString(token)
+	})
+	app.Post("/transfer", RequireBodyToken(cfg, 64), func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("GET", "/confirm", nil)
+	req.Header.Set("X-Tenant", "a")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	token := string(body)
+
+	// Signed with the key of the tenant, derived for the session
+	session := "alice" + SHA256KeyHash(payload)
+	utils.AssertEqual(t, true, verifyHMACToken(deriveKey([]byte("tenant-a"), "alice"), session, token))
+	utils.AssertEqual(t, false, verifyHMACToken([]byte("tenant-a"), session, token))
+
+	post := func(tenant string) int {
+		req := httptest.NewRequest("POST", "/transfer", strings.NewReader(payload))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		req.Header.Set("X-Tenant", tenant)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post("a"))
+	utils.AssertEqual(t, fiber.StatusForbidden, post("b"))
+
+	// Body tokens expire like other signed tokens
+	now = now.Add(2 * time.Minute)
+	utils.AssertEqual(t, fiber.StatusForbidden, post("a"))
+}
+
+// go test -run Test_CSRF_WhitespaceToken
+func Test_CSRF_WhitespaceToken(t *testing.T) {
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	app := fiber.New()
+	app.Use(New(Config{TokenLookup: "query:csrf,form:_csrf"}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		query, form string
+		status      int
+	}{
+		{"%20%20", "", fiber.StatusBadRequest},
+		{"", "%09+", fiber.StatusBadRequest},
+		{"+" + token + "+", "", fiber.StatusOK},
+		{"%20", "+" + token, fiber.StatusOK},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest("POST", "/?csrf="+tc.query, strings.NewReader("_csrf="+tc.form))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+}
+
+// go test -run Test_CSRF_Protect
+func Test_CSRF_Protect(t *testing.T) {
+	app := fiber.New()
+	app.Get("/open", func(c *fiber.Ctx) {})
+	app.Get("/export", Protect(Config{}), func(c *fiber.Ctx) {})
+
+	token := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	get := func(path, clientToken string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		if clientToken != "" {
+			req.Header.Set("X-CSRF-Token", clientToken)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, get("/open", ""))
+	utils.AssertEqual(t, fiber.StatusBadRequest, get("/export", ""))
+	utils.AssertEqual(t, fiber.StatusForbidden, get("/export", "wrong"))
+	utils.AssertEqual(t, fiber.StatusOK, get("/export", token))
+}
+
+// go test -run Test_CSRF_MalformedToken
+func Test_CSRF_MalformedToken(t *testing.T) {
+	var got []error
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:                 ModeHMAC,
+		Secret:               []byte("secret"),
+		SessionKey:           func(c *fiber.Ctx) string { return c.Cookies("session") },
+		MalformedTokenStatus: fiber.StatusBadRequest,
+		OnValidate:           func(c *fiber.Ctx, v Validation) { got = append(got, v.Err) },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "session=bob")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	bobs := resp.Cookies()[0].Value
+
+	testCases := []struct {
+		token  string
+		status int
+		err    error
+	}{
+		{"not-a-token", fiber.StatusBadRequest, ErrTokenMalformed},
+		{bobs[:len(bobs)-4], fiber.StatusBadRequest, ErrTokenMalformed},
+		{"~!!!", fiber.StatusBadRequest, ErrTokenMalformed},
+		// Well-formed, but signed for another session
+		{bobs, fiber.StatusForbidden, ErrBadSignature},
+	}
+	for _, tc := range testCases {
+		got = nil
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session=alice")
+		req.Header.Set("X-CSRF-Token", tc.token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, tc.token)
+		utils.AssertEqual(t, []error{tc.err}, got, tc.token)
+	}
+}
+
+// go test -run Test_CSRF_MigratePlainTokens
+func Test_CSRF_MigratePlainTokens(t *testing.T) {
+	plain := "6ba7b810-9dad-41d1-80b4-00c04fd430c8"
+	newApp := func(migrate bool) *fiber.App {
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:               ModeHMAC,
+			Secret:             []byte("secret"),
+			SessionKey:         func(c *fiber.Ctx) string { return "alice" },
+			MigratePlainTokens: migrate,
+		}))
+		app.Get("/", func(c *fiber.Ctx) {})
+		app.Post("/", func(c *fiber.Ctx) {})
+		return app
+	}
+	send := func(app *fiber.App, method, cookie, token string) *http.Response {
+		req := httptest.NewRequest(method, "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+cookie)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+	app := newApp(true)
+
+	// Unsafe requests of clients from before the switch still pass
+	resp := send(app, "POST", plain, plain)
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, fiber.StatusForbidden, send(app, "POST", plain, "other").StatusCode)
+
+	// The next GET upgrades the cookie, whose token then validates
+	resp = send(app, "GET", plain, "")
+	signed := resp.Cookies()[0].Value
+	utils.AssertEqual(t, true, signedTokenWellFormed(signed, false))
+	utils.AssertEqual(t, fiber.StatusOK, send(app, "POST", signed, signed).StatusCode)
+
+	// Without the option the plain token is rejected
+	utils.AssertEqual(t, fiber.StatusForbidden, send(newApp(false), "POST", plain, plain).StatusCode)
+}
+
+// go test -run Test_CSRF_Head
+func Test_CSRF_Head(t *testing.T) {
+	for _, skip := range []bool{false, true} {
+		app := fiber.New()
+		app.Use(New(Config{SkipCookieOnHead: skip}))
+		app.Head("/", func(c *fiber.Ctx) {
+			c.SendString("ignored for HEAD")
+		})
+
+		resp, err := app.Test(httptest.NewRequest("HEAD", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, 0, len(body))
+		utils.AssertEqual(t, !skip, resp.Header.Get(fiber.HeaderSetCookie) != "")
+	}
+}
+
+// go test -run Test_CSRF_State
+func Test_CSRF_State(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	var states []State
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:        ModeHMAC,
+		Secret:      []byte("secret"),
+		SessionKey:  func(c *fiber.Ctx) string { return "alice" },
+		TokenLookup: "header:X-CSRF-Token,query:csrf",
+		Now:         func() time.Time { return now },
+		ContextKey:  "token",
+	}))
+	handler := func(c *fiber.Ctx) {
+		state, ok := StateFromContext(c)
+		utils.AssertEqual(t, true, ok)
+		utils.AssertEqual(t, c.Locals("token"), state.Token)
+		states = append(states, state)
+	}
+	app.Get("/", handler)
+	app.Post("/", handler)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+
+	req := httptest.NewRequest("POST", "/?csrf="+token, nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+
+	utils.AssertEqual(t, []State{
+		{Token: token, IssuedAt: now.UTC(), Reason: ReasonSafeMethod},
+		{Token: token, Source: "query:csrf", IssuedAt: now.UTC(), Validated: true, Reason: ReasonValidated},
+	}, states)
+}
+
+// go test -run Test_CSRF_TimezoneChange
+func Test_CSRF_TimezoneChange(t *testing.T) {
+	instant := time.Unix(1600000000, 0)
+	zones := []*time.Location{time.FixedZone("EDT", -4*3600), time.FixedZone("EST", -5*3600), time.FixedZone("LINT", 14*3600)}
+	zone := zones[0]
+	clock := func() time.Time { return instant.In(zone) }
+
+	var got []Validation
+	newApp := func(bucket time.Duration) *fiber.App {
+		app := fiber.New()
+		app.Use(New(Config{
+			Mode:       ModeHMAC,
+			Secret:     []byte("secret"),
+			SessionKey: func(c *fiber.Ctx) string { return "alice" },
+			TimeBucket: bucket,
+			Now:        clock,
+			OnValidate: func(c *fiber.Ctx, v Validation) { got = append(got, v) },
+		}))
+		app.Get("/", func(c *fiber.Ctx) {})
+		app.Post("/", func(c *fiber.Ctx) {})
+		return app
+	}
+
+	for _, bucket := range []time.Duration{0, time.Hour} {
+		app := newApp(bucket)
+		zone = zones[0]
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		token := resp.Cookies()[0].Value
+
+		// The server's zone changes, the wall clock jumps, time doesn't
+		for _, zone = range zones[1:] {
+			got = nil
+			req := httptest.NewRequest("POST", "/", nil)
+			req.Header.Set("X-CSRF-Token", token)
+			resp, err := app.Test(req)
+			utils.AssertEqual(t, nil, err, "app.Test(req)")
+			utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode, zone.String())
+			utils.AssertEqual(t, time.Duration(0), got[0].Age)
+		}
+	}
+
+	issued, ok := tokenIssuedAt("nonce.1600000000.mac")
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, time.UTC, issued.Location())
+}
+
+// go test -run Test_CSRF_SafeMethods
+func Test_CSRF_SafeMethods(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		SafeMethods:          []string{"GET", "HEAD", "propfind"},
+		MethodOverrideHeader: "X-HTTP-Method-Override",
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Options("/", func(c *fiber.Ctx) {})
+
+	testCases := []struct {
+		method, override string
+		status           int
+	}{
+		{"GET", "", fiber.StatusOK},
+		{"GET", "PROPFIND", fiber.StatusOK},
+		{"GET", "MKCOL", fiber.StatusBadRequest},
+		// No longer in the safe set
+		{"OPTIONS", "", fiber.StatusBadRequest},
+	}
+	for _, tc := range testCases {
+		req := httptest.NewRequest(tc.method, "/", nil)
+		if tc.override != "" {
+			req.Header.Set("X-HTTP-Method-Override", tc.override)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode, fmt.Sprint(tc))
+	}
+}
+
+// go test -run Test_CSRF_TokenRefreshHandler
+func Test_CSRF_TokenRefreshHandler(t *testing.T) {
+	now := time.Now()
+	cfg := Config{
+		Mode:         ModeSplitToken,
+		CookieMaxAge: 86400,
+		TokenMaxAge:  60,
+		Now:          func() time.Time { return now },
+	}
+	app := fiber.New()
+	app.Get("/csrf/token", TokenRefreshHandler(cfg))
+	app.Use(New(cfg))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	cookies := map[string]*http.Cookie{}
+	for _, cookie := range resp.Cookies() {
+		cookies[cookie.Name] = cookie
+	}
+	secret, token := cookies["_csrf"], cookies["csrf_token"]
+	utils.AssertEqual(t, true, token.Expires.Before(secret.Expires.Add(-time.Hour)))
+	utils.AssertEqual(t, true, token.Expires.Before(time.Now().Add(2*time.Minute)))
+
+	post := func(token string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+secret.Value)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post(token.Value))
+
+	now = now.Add(2 * time.Minute)
+	utils.AssertEqual(t, fiber.StatusForbidden, post(token.Value))
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/csrf/token", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+
+	req := httptest.NewRequest("GET", "/csrf/token", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf="+secret.Value)
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	var body struct {
+		Token string `json:"token"`
+	}
+	utils.AssertEqual(t, nil, json.NewDecoder(resp.Body).Decode(&body))
+	for _, cookie := range resp.Cookies() {
+		utils.AssertEqual(t, "csrf_token", cookie.Name)
+		utils.AssertEqual(t, body.Token, cookie.Value)
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post(body.Token))
+}
+
+// go test -run Test_CSRF_LogsNoToken
+func Test_CSRF_LogsNoToken(t *testing.T) {
+	logs := map[string]map[string]interface{}{}
+	app := fiber.New()
+	app.Use(New(Config{
+		Debug:     true,
+		Blocklist: func(token string) bool { return token == "blocked" },
+		Logger: func(msg string, fields map[string]interface{}) {
+			logs[msg] = fields
+		},
+	}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	for clientToken, status := range map[string]int{
+		"blocked":     fiber.StatusForbidden,
+		"wrong-token": fiber.StatusForbidden,
+		"token":       fiber.StatusOK,
+	} {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+		req.Header.Set("X-CSRF-Token", clientToken)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, status, resp.StatusCode)
+	}
+	utils.AssertEqual(t, 3, len(logs))
+	for msg, fields := range logs {
+		utils.AssertEqual(t, "/", fields["path"], msg)
+		for key, value := range fields {
+			for _, token := range []string{"blocked", "wrong-token", "token"} {
+				utils.AssertEqual(t, false, strings.Contains(fmt.Sprint(value), token), msg+" "+key)
+			}
+		}
+	}
+	rejected := logs["token rejected"]
+	utils.AssertEqual(t, "POST", rejected["method"])
+	utils.AssertEqual(t, "header:X-CSRF-Token", rejected["source"])
+}
+
+// go test -run Test_CSRF_LogGuard
+func Test_CSRF_LogGuard(t *testing.T) {
+	cfg := configDefault(Config{
+		Debug:  true,
+		Logger: func(string, map[string]interface{}) {},
+	})
+	var recovered interface{}
+	app := fiber.New()
+	app.Use(New(cfg))
+	app.Get("/", func(c *fiber.Ctx) {
+		logEvent(c, cfg, "safe", map[string]interface{}{"path": c.Path()})
+		defer func() { recovered = recover() }()
+		logEvent(c, cfg, "leak", map[string]interface{}{"token": c.Locals("csrf")})
+	})
+
+	_, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "csrf: log field token contains a token", recovered)
+}
+
+// go test -run Test_CSRF_LogGuard_ClientTokens
+func Test_CSRF_LogGuard_ClientTokens(t *testing.T) {
+	logs := map[string]map[string]interface{}{}
+	logger := func(msg string, fields map[string]interface{}) {
+		logs[msg] = fields
+	}
+	app := fiber.New()
+	app.Use(New(Config{Debug: true, Logger: logger}))
+	app.Post("/", func(c *fiber.Ctx) {})
+	params := fiber.New()
+	params.Post("/p/:token", New(Config{Debug: true, Logger: logger, TokenLookup: "param:token"}), func(c *fiber.Ctx) {})
+
+	// Tokens chosen by the client never trip the guard, even if they equal
+	// an ordinary field
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=POST")
+	req.Header.Set("X-CSRF-Token", "/")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, "POST", logs["token rejected"]["method"])
+
+	req = httptest.NewRequest("POST", "/p/token", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+	resp, err = params.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "(redacted)", logs["timing"]["path"])
+}
+
+// go test -run Test_CSRF_LogGuard_SplitSecret
+func Test_CSRF_LogGuard_SplitSecret(t *testing.T) {
+	logs := map[string]map[string]interface{}{}
+	cfg := configDefault(Config{
+		Mode:  ModeSplitToken,
+		Debug: true,
+		Logger: func(msg string, fields map[string]interface{}) {
+			logs[msg] = fields
+		},
+	})
+	app := fiber.New()
+	app.Use(New(cfg))
+	app.Get("/", func(c *fiber.Ctx) {
+		logEvent(c, cfg, "issued", map[string]interface{}{"token": c.Locals("csrf")})
+	})
+	app.Post("/", func(c *fiber.Ctx) {
+		logEvent(c, cfg, "echo", map[string]interface{}{
+			"secret": c.Cookies("_csrf"),
+			"token":  c.Locals("csrf"),
+		})
+	})
+
+	// A pair the client signed itself is never guarded
+	token, err := generateHMACToken(bytes.NewReader(make([]byte, 64)), []byte("client-secret"), "", nil, time.Now())
+	utils.AssertEqual(t, nil, err)
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=client-secret; csrf_token="+token)
+	req.Header.Set("X-CSRF-Token", token)
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "client-secret", logs["echo"]["secret"])
+	utils.AssertEqual(t, token, logs["echo"]["token"])
+
+	// Outside of tests guarded fields are redacted, never a panic
+	panicOnLeak = false
+	defer func() { panicOnLeak = true }()
+	resp, err = app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "(redacted)", logs["issued"]["token"])
+}
+
+// go test -run Test_CSRF_LogPathRedacted
+func Test_CSRF_LogPathRedacted(t *testing.T) {
+	logs := map[string]map[string]interface{}{}
+	app := fiber.New()
+	app.Post("/x/:token", New(Config{
+		TokenLookup:   "header:X-CSRF-Token,param:token",
+		CorrelationID: func(c *fiber.Ctx) string { return "id" },
+		Logger: func(msg string, fields map[string]interface{}) {
+			logs[msg] = fields
+		},
+	}), func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("POST", "/x/secret-token-value", nil)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	rejected := logs["token rejected"]
+	utils.AssertEqual(t, "(redacted)", rejected["path"])
+	for key, value := range rejected {
+		utils.AssertEqual(t, false, strings.Contains(fmt.Sprint(value), "secret-token-value"), key)
+	}
+}
+
+// go test -run Test_CSRF_MissingTokenHandlers
+func Test_CSRF_MissingTokenHandlers(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		TokenLookup: "header:X-CSRF-Token,form:_csrf",
+		MissingTokenHandlers: map[string]func(*fiber.Ctx){
+			"header:X-CSRF-Token": func(c *fiber.Ctx) {
+				c.SendStatus(fiber.StatusUnauthorized)
+			},
+			"form:_csrf": func(c *fiber.Ctx) {
+				c.Redirect("/form", fiber.StatusSeeOther)
+			},
+		},
+	}))
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("POST", "/", strings.NewReader(`{"name":"gopher"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	req = httptest.NewRequest("POST", "/", strings.NewReader("name=gopher"))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusSeeOther, resp.StatusCode)
+	utils.AssertEqual(t, "/form", resp.Header.Get(fiber.HeaderLocation))
+
+	// Invalid tokens keep the usual status
+	req = httptest.NewRequest("POST", "/", strings.NewReader("_csrf=wrong"))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationForm)
+	req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+
+	defer func() {
+		utils.AssertEqual(t, "csrf: MissingTokenHandlers source query:csrf is not in TokenLookup", recover())
+	}()
+	New(Config{MissingTokenHandlers: map[string]func(*fiber.Ctx){"query:csrf": nil}})
+}
+
+// go test -run Test_CSRF_LegacySameSite
+func Test_CSRF_LegacySameSite(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		CookieSameSite: "None",
+		CookieSecure:   true,
+		SameSiteFunc:   LegacySameSite,
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	for ua, sameSite := range map[string]bool{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 12_4 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Mobile/15E148 Safari/604.1":         false,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/13.0 Safari/605.1.15":                             false,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/60.0.3112.113 Safari/537.36":                               false,
+		"Mozilla/5.0 (Linux; U; Android 8.0.0; en-US; Pixel XL Build/OPR3.170623.007) AppleWebKit/534.30 (KHTML, like Gecko) UCBrowser/12.10.8.1172 Mobile": false,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                                   true,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_14_6) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36":                             true,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1":           true,
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderUserAgent, ua)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		cookie := resp.Header.Get(fiber.HeaderSetCookie)
+		utils.AssertEqual(t, true, strings.HasPrefix(cookie, "_csrf="), ua)
+		utils.AssertEqual(t, sameSite, strings.Contains(cookie, "SameSite=None"), ua)
+		utils.AssertEqual(t, sameSite, strings.Contains(strings.ToLower(cookie), "samesite"), ua)
+		utils.AssertEqual(t, true, strings.Contains(cookie, "secure"), ua)
+	}
+}
+
+// go test -run Test_CSRF_VerifyOnly
+func Test_CSRF_VerifyOnly(t *testing.T) {
+	session := func(c *fiber.Ctx) string { return c.Cookies("session") }
+	issuer := func(secret string) string {
+		app := fiber.New()
+		app.Use(New(Config{Mode: ModeHMAC, Secret: []byte(secret), SessionKey: session}))
+		app.Get("/", func(c *fiber.Ctx) {})
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session=alice")
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.Cookies()[0].Value
+	}
+	genuine, forged := issuer("shared"), issuer("other")
+
+	var contextToken interface{}
+	app := fiber.New()
+	app.Use(New(Config{Mode: ModeHMAC, Secret: []byte("shared"), SessionKey: session, VerifyOnly: true}))
+	app.Get("/", func(c *fiber.Ctx) {
+		contextToken = c.Locals("csrf")
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	post := func(token string) *http.Response {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "session=alice; _csrf="+token)
+		req.Header.Set("X-CSRF-Token", token)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+	resp := post(genuine)
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+	resp = post(forged)
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "session=alice; _csrf="+forged)
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+	utils.AssertEqual(t, "", contextToken)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(fiber.HeaderCookie, "session=alice; _csrf="+genuine)
+	_, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, genuine, contextToken)
+
+	defer func() {
+		utils.AssertEqual(t, "csrf: VerifyOnly requires ModeHMAC or ModeSaltedHMAC", recover())
+	}()
+	New(Config{VerifyOnly: true})
+}
+
+// failingReader is a RandReader that always fails.
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, errors.New("entropy unavailable")
+}
+
+// go test -run Test_CSRF_GeneratorError
+func Test_CSRF_GeneratorError(t *testing.T) {
+	session := func(c *fiber.Ctx) string { return "alice" }
+	for _, tc := range []struct {
+		cfg    Config
+		status int
+	}{
+		{Config{RandReader: failingReader{}}, fiber.StatusInternalServerError},
+		{Config{RandReader: failingReader{}, GeneratorErrorStatus: fiber.StatusServiceUnavailable}, fiber.StatusServiceUnavailable},
+		{Config{Mode: ModeHMAC, Secret: []byte("secret"), SessionKey: session, RandReader: failingReader{}}, fiber.StatusInternalServerError},
+		{Config{Mode: ModeSplitToken, RandReader: failingReader{}}, fiber.StatusInternalServerError},
+		{Config{Generator: func(io.Reader, time.Time) (string, error) { return "", nil }}, fiber.StatusInternalServerError},
+	} {
+		var logs []string
+		tc.cfg.Logger = func(msg string, fields map[string]interface{}) {
+			logs = append(logs, fmt.Sprint(msg, fields["error"]))
+		}
+		app := fiber.New()
+		app.Use(New(tc.cfg))
+		app.Get("/", func(c *fiber.Ctx) {})
+
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		utils.AssertEqual(t, tc.status, resp.StatusCode)
+		utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+		utils.AssertEqual(t, 1, len(logs))
+		utils.AssertEqual(t, true, strings.HasPrefix(logs[0], "token generation failed"), logs[0])
+	}
+}
+
+// go test -run Test_CSRF_CorrelationID
+func Test_CSRF_CorrelationID(t *testing.T) {
+	logs := map[string]map[string]interface{}{}
+	var validation Validation
+	var state State
+	app := fiber.New()
+	app.Use(New(Config{
+		CorrelationID: func(c *fiber.Ctx) string { return "req-" + c.Get("X-Request-ID") },
+		Logger: func(msg string, fields map[string]interface{}) {
+			logs[msg] = fields
+		},
+		OnValidate: func(c *fiber.Ctx, v Validation) {
+			validation = v
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {
+		state, _ = StateFromContext(c)
+	})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-Request-ID", "1")
+	req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+	req.Header.Set("X-CSRF-Token", "wrong")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, "req-1", resp.Header.Get("X-CSRF-Correlation-ID"))
+	utils.AssertEqual(t, "req-1", logs["token rejected"]["correlation_id"])
+	utils.AssertEqual(t, "/", logs["token rejected"]["path"])
+	utils.AssertEqual(t, "req-1", validation.CorrelationID)
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "2")
+	resp, err = app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, "req-2", resp.Header.Get("X-CSRF-Correlation-ID"))
+	utils.AssertEqual(t, "req-2", state.CorrelationID)
+}
+
+// go test -run Test_CSRF_ValidateSafeAgainstStorage
+func Test_CSRF_ValidateSafeAgainstStorage(t *testing.T) {
+	var validation Validation
+	cfg := Config{
+		Mode:                       ModeSynchronizer,
+		Storage:                    NewMemoryStorage(),
+		SessionKey:                 func(c *fiber.Ctx) string { return "alice" },
+		ValidateSafeAgainstStorage: true,
+		OnValidate: func(c *fiber.Ctx, v Validation) {
+			validation = v
+		},
+	}
+	app := fiber.New()
+	app.Use(New(cfg))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	get := func(cookie string) *http.Response {
+		req := httptest.NewRequest("GET", "/", nil)
+		if cookie != "" {
+			req.Header.Set(fiber.HeaderCookie, "_csrf="+cookie)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+	resp := get("")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	token := resp.Cookies()[0].Value
+	utils.AssertEqual(t, fiber.StatusOK, get(token).StatusCode)
+
+	// Revoke the token
+	utils.AssertEqual(t, nil, cfg.Storage.Delete(storageKey(configDefault(cfg), "alice")))
+	resp = get(token)
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, ErrTokenRevoked, validation.Err)
+	fresh := resp.Cookies()[0].Value
+	utils.AssertEqual(t, true, fresh != token)
+	utils.AssertEqual(t, fiber.StatusForbidden, get("forged").StatusCode)
+	utils.AssertEqual(t, fiber.StatusOK, get(fresh).StatusCode)
+
+	defer func() {
+		utils.AssertEqual(t, "csrf: ValidateSafeAgainstStorage requires ModeSynchronizer without TrustCookie", recover())
+	}()
+	New(Config{ValidateSafeAgainstStorage: true})
+}
+
+// go test -run Test_CSRF_TokenEncoding
+func Test_CSRF_TokenEncoding(t *testing.T) {
+	app := fiber.New()
+	app.Use(New(Config{
+		Generator:     AlphabetGenerator("0123456789abcdef", 64),
+		TokenEncoding: "hex",
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	token := resp.Cookies()[0].Value
+	raw, err := hex.DecodeString(token)
+	utils.AssertEqual(t, nil, err)
+
+	post := func(header string) int {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set(fiber.HeaderCookie, "_csrf="+token)
+		req.Header.Set("X-CSRF-Token", header)
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp.StatusCode
+	}
+	utils.AssertEqual(t, fiber.StatusOK, post(token))
+	utils.AssertEqual(t, fiber.StatusOK, post(base64.RawURLEncoding.EncodeToString(raw)))
+	utils.AssertEqual(t, fiber.StatusOK, post(base64.StdEncoding.EncodeToString(raw)))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(base64.StdEncoding.EncodeToString(raw[1:])))
+	utils.AssertEqual(t, fiber.StatusForbidden, post(strings.Repeat("0", 64)))
+
+	func() {
+		defer func() {
+			utils.AssertEqual(t, "csrf: TokenEncoding requires a Generator or Alphabet of encoded tokens", recover())
+		}()
+		New(Config{TokenEncoding: "hex"})
+	}()
+	defer func() {
+		utils.AssertEqual(t, "csrf: TokenEncoding can't be combined with EnforceTokenLength or HashVerify", recover())
+	}()
+	New(Config{TokenEncoding: "hex", EnforceTokenLength: true})
+}
+
+// go test -run Test_CSRF_PolicyHook
+func Test_CSRF_PolicyHook(t *testing.T) {
+	var decisions []Decision
+	handled := 0
+	app := fiber.New()
+	app.Use(New(Config{
+		PolicyHook: func(c *fiber.Ctx, d Decision) error {
+			decisions = append(decisions, d)
+			if d.Method == fiber.MethodPost && c.Get("Sec-Fetch-Site") == "cross-site" {
+				return fiber.NewError(fiber.StatusForbidden, "cross-site writes are denied")
+			}
+			return nil
+		},
+	}))
+	app.Post("/", func(c *fiber.Ctx) {
+		handled++
+	})
+
+	post := func(site, token string) *http.Response {
+		req := httptest.NewRequest("POST", "/", nil)
+		req.Header.Set("Sec-Fetch-Site", site)
+		req.Header.Set(fiber.HeaderCookie, "_csrf=token")
+		if token != "" {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+		resp, err := app.Test(req)
+		utils.AssertEqual(t, nil, err, "app.Test(req)")
+		return resp
+	}
+
+	// Approved
+	resp := post("same-origin", "token")
+	utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	utils.AssertEqual(t, 1, handled)
+	utils.AssertEqual(t, Decision{
+		Method:  fiber.MethodPost,
+		Path:    "/",
+		Source:  "header:X-CSRF-Token",
+		Allowed: true,
+		Reason:  ReasonValidated,
+	}, decisions[0])
+
+	// Vetoed despite a valid token
+	resp = post("cross-site", "token")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, "cross-site writes are denied", string(body))
+	utils.AssertEqual(t, 1, handled)
+	utils.AssertEqual(t, true, decisions[1].Allowed)
+
+	// Rejections are reported and stand
+	resp = post("same-origin", "")
+	utils.AssertEqual(t, fiber.StatusBadRequest, resp.StatusCode)
+	utils.AssertEqual(t, 3, len(decisions))
+	utils.AssertEqual(t, false, decisions[2].Allowed)
+	utils.AssertEqual(t, fiber.StatusBadRequest, decisions[2].Status)
+}
+
+// go test -run Test_CSRF_PolicyHook_VetoIssuesNothing
+func Test_CSRF_PolicyHook_VetoIssuesNothing(t *testing.T) {
+	storage := &countingStorage{Storage: NewMemoryStorage()}
+	app := fiber.New()
+	app.Use(New(Config{
+		Mode:       ModeSynchronizer,
+		Storage:    storage,
+		SessionKey: func(c *fiber.Ctx) string { return "alice" },
+		PolicyHook: func(c *fiber.Ctx, d Decision) error {
+			return fiber.NewError(fiber.StatusForbidden, "denied")
+		},
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	utils.AssertEqual(t, "", resp.Header.Get(fiber.HeaderSetCookie))
+	utils.AssertEqual(t, 0, storage.tokenSets)
+}
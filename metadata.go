@@ -0,0 +1,55 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber"
+)
+
+// Metadata is the body written by MetadataHandler.
+type Metadata struct {
+	Token      string `json:"token"`
+	HeaderName string `json:"headerName,omitempty"`
+	FormField  string `json:"formField,omitempty"`
+	QueryParam string `json:"queryParam,omitempty"`
+	CookieName string `json:"cookieName,omitempty"`
+}
+
+// MetadataHandler responds with the token of the request and where the
+// active config expects it, so a SPA can configure itself with one GET.
+// Mount it behind the middleware created with the same config, e.g.
+// app.Get("/csrf", csrf.New(cfg), csrf.MetadataHandler(cfg)).
+func MetadataHandler(config Config) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	meta := Metadata{}
+	for _, lookup := range strings.Split(cfg.TokenLookup, ",") {
+		parts := strings.Split(strings.TrimSpace(lookup), ":")
+		switch parts[0] {
+		case "header":
+			meta.HeaderName = parts[1]
+		case "form":
+			meta.FormField = parts[1]
+		case "query":
+			meta.QueryParam = parts[1]
+		}
+	}
+	if !cfg.CookieDisabled {
+		meta.CookieName = cfg.CookieName
+		if cfg.Mode == ModeSplitToken {
+			meta.CookieName = cfg.TokenCookieName
+		}
+	}
+	return func(c *fiber.Ctx) {
+		m := meta
+		m.Token, _ = c.Locals(cfg.ContextKey).(string)
+		if m.Token == "" {
+			c.SendStatus(fiber.StatusInternalServerError)
+			return
+		}
+		_ = c.JSON(m)
+	}
+}
@@ -0,0 +1,80 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber"
+)
+
+// decidedKey marks requests the middleware accepted, so that PolicyHook
+// learns about the others once the middleware returns.
+const decidedKey = "github.com/gofiber/csrf.decided"
+
+// Decision describes the middleware's decision on a request for PolicyHook.
+type Decision struct {
+	// Method and Path of the request.
+	Method string
+	Path   string
+	// Source is the TokenLookup source the request token was read from, or
+	// "" if none was read.
+	Source string
+	// Allowed reports whether the middleware accepts the request.
+	Allowed bool
+	// Reason is the SkipReason of an allowed request.
+	Reason string
+	// Status is the response status of a rejected request.
+	Status int
+	// IssuedAt is when the request's token was minted, or the zero time for
+	// tokens that don't carry a signed timestamp. The hook runs before a
+	// request without a token is issued one, so it is zero for them too.
+	IssuedAt time.Time
+	// CorrelationID is the id CorrelationID gave the request, if set.
+	CorrelationID string
+}
+
+// allow reports whether an accepted request may go on, after consulting
+// PolicyHook about it and its token, if any. A veto is handed to the app's
+// ErrorHandler.
+func allow(c *fiber.Ctx, cfg Config, token string) bool {
+	if cfg.PolicyHook == nil {
+		return true
+	}
+	c.Locals(decidedKey, true)
+	d := newDecision(c)
+	d.Allowed, d.Reason = true, SkipReason(c)
+	d.IssuedAt, _ = tokenIssuedAt(token)
+	if err := cfg.PolicyHook(c, d); err != nil {
+		c.Next(err)
+		return false
+	}
+	return true
+}
+
+// withPolicyHook also reports the requests handler rejects to PolicyHook.
+// The rejection stands whatever the hook returns.
+func withPolicyHook(cfg Config, handler func(*fiber.Ctx)) func(*fiber.Ctx) {
+	if cfg.PolicyHook == nil {
+		return handler
+	}
+	return func(c *fiber.Ctx) {
+		c.Locals(decidedKey, nil)
+		handler(c)
+		if c.Locals(decidedKey) == nil {
+			d := newDecision(c)
+			d.Status = c.Fasthttp.Response.StatusCode()
+			_ = cfg.PolicyHook(c, d)
+		}
+	}
+}
+
+// newDecision returns the Decision fields common to every request.
+func newDecision(c *fiber.Ctx) Decision {
+	d := Decision{Method: c.Method(), Path: c.Path()}
+	d.Source, _ = c.Locals(sourceKey).(string)
+	d.CorrelationID, _ = c.Locals(correlationKey).(string)
+	return d
+}
@@ -0,0 +1,52 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"reflect"
+)
+
+// DevConfig returns a preset for local development: cookies readable from
+// JavaScript and sent over plain HTTP, SameSite Lax, and Debug diagnostics.
+func DevConfig() Config {
+	return Config{
+		CookieSecure:   false,
+		CookieHTTPOnly: false,
+		CookieSameSite: "Lax",
+		Debug:          true,
+	}
+}
+
+// ProdConfig returns a preset for production: Secure, HTTP only and SameSite
+// Strict cookies. If secret is given, tokens are signed with ModeHMAC, which
+// also requires SessionKey to be set in an override.
+func ProdConfig(secret []byte) Config {
+	cfg := Config{
+		CookieSecure:   true,
+		CookieHTTPOnly: true,
+		CookieSameSite: "Strict",
+	}
+	if len(secret) > 0 {
+		cfg.Mode = ModeHMAC
+		cfg.Secret = secret
+	}
+	return cfg
+}
+
+// mergeConfig returns base with every field that is set in override, i.e.
+// not the zero value, replaced by the value from override. As false is the
+// zero value, an override can't turn off a flag the base enables; callers
+// must clear it on the base instead.
+func mergeConfig(base, override Config) Config {
+	b := reflect.ValueOf(&base).Elem()
+	o := reflect.ValueOf(override)
+	for i := 0; i < o.NumField(); i++ {
+		f := o.Field(i)
+		if !reflect.DeepEqual(f.Interface(), reflect.Zero(f.Type()).Interface()) {
+			b.Field(i).Set(f)
+		}
+	}
+	return base
+}
@@ -0,0 +1,69 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_Presets
+func Test_Presets(t *testing.T) {
+	dev := DevConfig()
+	utils.AssertEqual(t, false, dev.CookieSecure)
+	utils.AssertEqual(t, false, dev.CookieHTTPOnly)
+	utils.AssertEqual(t, "Lax", dev.CookieSameSite)
+	utils.AssertEqual(t, true, dev.Debug)
+
+	prod := ProdConfig(nil)
+	utils.AssertEqual(t, true, prod.CookieSecure)
+	utils.AssertEqual(t, true, prod.CookieHTTPOnly)
+	utils.AssertEqual(t, "Strict", prod.CookieSameSite)
+	utils.AssertEqual(t, ModeDoubleSubmit, prod.Mode)
+
+	prod = ProdConfig([]byte("secret"))
+	utils.AssertEqual(t, ModeHMAC, prod.Mode)
+	utils.AssertEqual(t, "secret", string(prod.Secret))
+}
+
+// go test -run Test_Presets_Overrides
+func Test_Presets_Overrides(t *testing.T) {
+	cfg := configDefault(ProdConfig(nil), Config{CookieName: "_csrf_shop", CookieSameSite: "Lax"})
+	utils.AssertEqual(t, "_csrf_shop", cfg.CookieName)
+	utils.AssertEqual(t, "Lax", cfg.CookieSameSite)
+	utils.AssertEqual(t, true, cfg.CookieSecure)
+	utils.AssertEqual(t, "header:X-CSRF-Token", cfg.TokenLookup)
+
+	app := fiber.New()
+	app.Use(New(ProdConfig([]byte("secret")), Config{
+		SessionKey: func(c *fiber.Ctx) string { return "alice" },
+	}))
+	app.Get("/", func(c *fiber.Ctx) {})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	cookie := resp.Header.Get(fiber.HeaderSetCookie)
+	utils.AssertEqual(t, true, strings.Contains(cookie, "secure"), cookie)
+	utils.AssertEqual(t, true, strings.Contains(cookie, "HttpOnly"), cookie)
+	utils.AssertEqual(t, true, strings.Contains(cookie, "SameSite=Strict"), cookie)
+	utils.AssertEqual(t, 3, len(strings.Split(resp.Cookies()[0].Value, ".")))
+}
+
+// go test -run Test_Presets_DisableFlag
+func Test_Presets_DisableFlag(t *testing.T) {
+	// A false override is the zero value and leaves the preset's flag on
+	cfg := configDefault(DevConfig(), Config{Debug: false, CookieName: "_csrf_dev"})
+	utils.AssertEqual(t, true, cfg.Debug)
+
+	dev := DevConfig()
+	dev.Debug = false
+	cfg = configDefault(dev, Config{CookieName: "_csrf_dev"})
+	utils.AssertEqual(t, false, cfg.Debug)
+	utils.AssertEqual(t, "_csrf_dev", cfg.CookieName)
+}
@@ -0,0 +1,18 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// Protect returns the middleware of New that validates every request it
+// handles, whatever its method, for attaching to individual routes such as
+// app.Get("/export", csrf.Protect(cfg), handler). It is New with
+// ValidateSafeMethods set.
+func Protect(config Config) func(*fiber.Ctx) {
+	config.ValidateSafeMethods = true
+	return New(config)
+}
@@ -0,0 +1,24 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// RequireQueryToken returns a handler that requires a valid token in the
+// query parameter param, for link-based actions such as one-click
+// unsubscribe that are reached with GET. Mount it only on those routes:
+// other safe requests stay unvalidated by New.
+func RequireQueryToken(config Config, param string) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	extractor := csrfFromQuery(param)
+	return func(c *fiber.Ctx) {
+		if _, ok := verifyRequest(c, cfg, extractor); !ok {
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,38 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// Reasons reported by SkipReason.
+const (
+	// ReasonFiltered means Filter skipped the middleware.
+	ReasonFiltered = "filtered"
+	// ReasonExemptPath means the path is listed in ExemptPaths.
+	ReasonExemptPath = "exempt-path"
+	// ReasonSkipHeader means a SkipIfHeaderPresent header applied.
+	ReasonSkipHeader = "skip-header"
+	// ReasonSafeMethod means the method is safe and wasn't validated.
+	ReasonSafeMethod = "safe-method"
+	// ReasonSameOrigin means TrustSameOriginFetch skipped validation.
+	ReasonSameOrigin = "same-origin"
+	// ReasonXRequestedWith means TrustXRequestedWith skipped validation.
+	ReasonXRequestedWith = "x-requested-with"
+	// ReasonValidated means the request carried a valid token.
+	ReasonValidated = "validated"
+)
+
+// reasonKey is the Locals key the middleware stores its reason under.
+const reasonKey = "github.com/gofiber/csrf.reason"
+
+// SkipReason returns why the middleware let the request through, i.e. one of
+// the Reason constants, or "" if it hasn't run for this request. Use it at
+// the end of the chain to debug middleware ordering.
+func SkipReason(c *fiber.Ctx) string {
+	reason, _ := c.Locals(reasonKey).(string)
+	return reason
+}
@@ -0,0 +1,107 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"github.com/gofiber/fiber"
+)
+
+// RefreshHandler rotates the token of long-lived clients without a full page
+// load. The request must carry its current, valid token in TokenLookup; the
+// response sets fresh cookies and returns the new token as {"token": "..."}.
+func RefreshHandler(config Config) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	if cfg.VerifyOnly {
+		panic("csrf: RefreshHandler can't issue tokens with VerifyOnly")
+	}
+	extractor := newExtractor(cfg.TokenLookup, cfg.RequireAllSources, cfg.MaxSourceAttempts, cfg.DuplicateTokenFields)
+	return func(c *fiber.Ctx) {
+		b, ok := verifyRequest(c, cfg, extractor)
+		if !ok {
+			return
+		}
+		secret, token, err := newToken(cfg, b)
+		if err != nil {
+			sendTokenError(c, cfg, err)
+			return
+		}
+		writeCookies(c, cfg, secret, token)
+		storeToken(c, cfg, token)
+		appendVary(c, cfg.VaryExclude, fiber.HeaderCookie)
+		_ = c.JSON(fiber.Map{"token": token})
+	}
+}
+
+// TokenRefreshHandler mints a fresh short-lived token from the long-lived
+// secret cookie of ModeSplitToken, e.g. once TokenMaxAge has passed. The
+// request needs no token, only the secret cookie; the response sets the
+// token cookie and returns the token as {"token": "..."}. Cross-site pages
+// can't read the response, so serving it without validation is safe.
+func TokenRefreshHandler(config Config) func(*fiber.Ctx) {
+	cfg := configDefault(config)
+	if cfg.Mode != ModeSplitToken {
+		panic("csrf: TokenRefreshHandler requires ModeSplitToken")
+	}
+	return func(c *fiber.Ctx) {
+		b, err := newBinding(c, cfg)
+		if err != nil {
+			c.SendStatus(fiber.StatusServiceUnavailable)
+			return
+		}
+		secret := readCookie(c, cfg, cfg.CookieName)
+		if secret == "" {
+			c.SendStatus(fiber.StatusForbidden)
+			return
+		}
+		token, err := signToken(cfg, []byte(secret), b)
+		if err != nil {
+			sendTokenError(c, cfg, err)
+			return
+		}
+		writeTokenCookie(c, cfg, token)
+		storeToken(c, cfg, token)
+		appendVary(c, cfg.VaryExclude, fiber.HeaderCookie)
+		_ = c.JSON(fiber.Map{"token": token})
+	}
+}
+
+// verifyRequest validates the token extracted from the request outside of
+// the main middleware. On failure it responds with the matching status and
+// returns false. It never mints or stores a token: loadToken only marks a
+// missing one pending, so callers persist only after validation succeeds.
+func verifyRequest(c *fiber.Ctx, cfg Config, extractor func(*fiber.Ctx) (string, error)) (binding, bool) {
+	b, err := newBinding(c, cfg)
+	if err != nil {
+		c.SendStatus(fiber.StatusServiceUnavailable)
+		return b, false
+	}
+	secret, token, err := loadToken(c, cfg, &b)
+	if err == ErrStorageCookieMismatch {
+		c.SendStatus(fiber.StatusForbidden)
+		return b, false
+	} else if err != nil {
+		sendTokenError(c, cfg, err)
+		return b, false
+	}
+	clientToken, err := extractor(c)
+	if err == ErrSourcesDisagree || err == ErrDuplicateToken {
+		c.SendStatus(fiber.StatusForbidden)
+		return b, false
+	} else if err != nil {
+		c.SendStatus(fiber.StatusBadRequest)
+		return b, false
+	}
+	clientToken = stripVersion(clientToken, tokenVersions(cfg))
+	never, err := neverIssued(cfg, clientToken)
+	if err != nil {
+		c.SendStatus(fiber.StatusInternalServerError)
+		return b, false
+	}
+	if never || isBlocked(c, cfg, clientToken) || !checkToken(cfg, b, secret, token, clientToken) {
+		c.SendStatus(fiber.StatusForbidden)
+		return b, false
+	}
+	return b, true
+}
@@ -0,0 +1,87 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	ios12UA         = regexp.MustCompile(`\(iP.+; CPU .*OS 12[_\d]*.*\) AppleWebKit/`)
+	macOS1014UA     = regexp.MustCompile(`\(Macintosh;.*Mac OS X 10_14[_\d]*.*\) AppleWebKit/`)
+	safariUA        = regexp.MustCompile(`Version/.* Safari/`)
+	macEmbeddedUA   = regexp.MustCompile(`^Mozilla/[.\d]+ \(Macintosh;.*Mac OS X [_\d]+\) AppleWebKit/[.\d]+ \(KHTML, like Gecko\)$`)
+	chromiumUA      = regexp.MustCompile(`Chrom(e|ium)/(\d+)\.`)
+	ucBrowserUA     = regexp.MustCompile(`UCBrowser/(\d+)\.(\d+)\.(\d+)\.`)
+	chromiumBasedUA = regexp.MustCompile(`Chrom(e|ium)`)
+)
+
+// LegacySameSite is a SameSiteFunc that omits SameSite=None for user agents
+// that mishandle it: iOS 12 and Safari on macOS 10.14 treat it as Strict,
+// Chrome 51 to 66 and UC Browser before 12.13.2 reject such cookies.
+func LegacySameSite(c *fiber.Ctx, sameSite string) string {
+	if strings.EqualFold(sameSite, "None") && sameSiteNoneIncompatible(c.Get(fiber.HeaderUserAgent)) {
+		return ""
+	}
+	return sameSite
+}
+
+// sameSiteNoneIncompatible reports whether ua is known to mishandle
+// SameSite=None.
+func sameSiteNoneIncompatible(ua string) bool {
+	if ios12UA.MatchString(ua) {
+		return true
+	}
+	if macOS1014UA.MatchString(ua) && ((safariUA.MatchString(ua) && !chromiumBasedUA.MatchString(ua)) || macEmbeddedUA.MatchString(ua)) {
+		return true
+	}
+	if m := chromiumUA.FindStringSubmatch(ua); m != nil {
+		if major, err := strconv.Atoi(m[2]); err == nil && major >= 51 && major <= 66 {
+			return true
+		}
+	}
+	if m := ucBrowserUA.FindStringSubmatch(ua); m != nil {
+		version := [3]int{}
+		for i := range version {
+			version[i], _ = strconv.Atoi(m[i+1])
+		}
+		if version[0] != 12 {
+			return version[0] < 12
+		}
+		if version[1] != 13 {
+			return version[1] < 13
+		}
+		return version[2] < 2
+	}
+	return false
+}
+
+// sendCookie sets cookie on the response after passing its SameSite through
+// SameSiteFunc. Fiber always writes the attribute, so cookies without one
+// are set through fasthttp.
+func sendCookie(c *fiber.Ctx, cfg Config, cookie *fiber.Cookie) {
+	if cfg.SameSiteFunc != nil {
+		cookie.SameSite = cfg.SameSiteFunc(c, cookie.SameSite)
+	}
+	if cookie.SameSite != "" {
+		c.Cookie(cookie)
+		return
+	}
+	fcookie := fasthttp.AcquireCookie()
+	defer fasthttp.ReleaseCookie(fcookie)
+	fcookie.SetKey(cookie.Name)
+	fcookie.SetValue(cookie.Value)
+	fcookie.SetPath(cookie.Path)
+	fcookie.SetDomain(cookie.Domain)
+	fcookie.SetExpire(cookie.Expires)
+	fcookie.SetSecure(cookie.Secure)
+	fcookie.SetHTTPOnly(cookie.HTTPOnly)
+	c.Fasthttp.Response.Header.SetCookie(fcookie)
+}
@@ -0,0 +1,140 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Storage is the interface for server-side token state.
+type Storage interface {
+	// Get returns the value for key, or nil if key does not exist or expired.
+	Get(key string) ([]byte, error)
+	// Set stores val for key. An exp of 0 means no expiration.
+	Set(key string, val []byte, exp time.Duration) error
+	// Delete removes key. It is not an error if key does not exist.
+	Delete(key string) error
+}
+
+// ScopedStorage is implemented by storages that can check and consume a
+// scoped token in one atomic step, so that concurrent requests can't use a
+// single-use token twice. RequireChallenge uses it when available and falls
+// back to Get followed by Delete otherwise.
+type ScopedStorage interface {
+	Storage
+	// ValidateScopedAndConsume reports whether token is stored for the
+	// session, hashed with StorageKeyHash, and scope, and deletes it if so.
+	// Tokens of other scopes are left untouched.
+	ValidateScopedAndConsume(sessionKey, scope, token string) (bool, error)
+}
+
+// scopedKey returns the storage key of a token stored for a session and scope.
+func scopedKey(sessionKey, scope, token string) string {
+	return "challenge:" + sessionKey + ":" + scope + ":" + token
+}
+
+// SHA256KeyHash is the default StorageKeyHash. It returns the hex encoded
+// SHA-256 digest of key.
+func SHA256KeyHash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type memoryEntry struct {
+	val []byte
+	exp time.Time
+}
+
+type memoryStorage struct {
+	mu   sync.Mutex
+	data map[string]memoryEntry
+	// every is the number of operations between sweeps, 0 disables them.
+	every int
+	ops   int
+}
+
+// NewMemoryStorage returns an in-memory Storage, suitable for a single
+// instance. Expired entries are removed when they are read. It implements
+// ScopedStorage.
+func NewMemoryStorage() Storage {
+	return &memoryStorage{data: make(map[string]memoryEntry)}
+}
+
+// NewMemoryStorageWithCleanup is like NewMemoryStorage but also removes all
+// expired entries every that many operations, which bounds memory when many
+// keys are written once and never read again, e.g. under bursty traffic.
+// A sweep takes time linear in the number of entries.
+func NewMemoryStorageWithCleanup(every int) Storage {
+	return &memoryStorage{data: make(map[string]memoryEntry), every: every}
+}
+
+// tick counts an operation and sweeps expired entries every s.every
+// operations. s.mu must be held.
+func (s *memoryStorage) tick() {
+	if s.every <= 0 {
+		return
+	}
+	if s.ops++; s.ops < s.every {
+		return
+	}
+	s.ops = 0
+	now := time.Now()
+	for key, e := range s.data {
+		if !e.exp.IsZero() && now.After(e.exp) {
+			delete(s.data, key)
+		}
+	}
+}
+
+func (s *memoryStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tick()
+	e, ok := s.data[key]
+	if !ok {
+		return nil, nil
+	}
+	if !e.exp.IsZero() && time.Now().After(e.exp) {
+		delete(s.data, key)
+		return nil, nil
+	}
+	return e.val, nil
+}
+
+func (s *memoryStorage) Set(key string, val []byte, exp time.Duration) error {
+	e := memoryEntry{val: val}
+	if exp > 0 {
+		e.exp = time.Now().Add(exp)
+	}
+	s.mu.Lock()
+	s.tick()
+	s.data[key] = e
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	s.tick()
+	delete(s.data, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *memoryStorage) ValidateScopedAndConsume(sessionKey, scope, token string) (bool, error) {
+	key := scopedKey(sessionKey, scope, token)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tick()
+	e, ok := s.data[key]
+	if !ok {
+		return false, nil
+	}
+	delete(s.data, key)
+	return e.exp.IsZero() || !time.Now().After(e.exp), nil
+}
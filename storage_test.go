@@ -0,0 +1,77 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_MemoryStorage
+func Test_MemoryStorage(t *testing.T) {
+	s := NewMemoryStorage()
+
+	utils.AssertEqual(t, nil, s.Set("a", []byte("1"), 0))
+	utils.AssertEqual(t, nil, s.Set("b", []byte("2"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	val, err := s.Get("a")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, []byte("1"), val)
+
+	val, err = s.Get("b")
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, val == nil)
+
+	utils.AssertEqual(t, nil, s.Delete("a"))
+	val, _ = s.Get("a")
+	utils.AssertEqual(t, true, val == nil)
+}
+
+// go test -run Test_MemoryStorage_ValidateScopedAndConsume
+func Test_MemoryStorage_ValidateScopedAndConsume(t *testing.T) {
+	s := NewMemoryStorage().(ScopedStorage)
+	utils.AssertEqual(t, nil, s.Set(scopedKey("alice", "a", "t1"), []byte{1}, 0))
+	utils.AssertEqual(t, nil, s.Set(scopedKey("alice", "b", "t2"), []byte{1}, 0))
+	utils.AssertEqual(t, nil, s.Set(scopedKey("alice", "a", "t3"), []byte{1}, time.Nanosecond))
+	time.Sleep(time.Millisecond)
+
+	for _, tc := range []struct {
+		session, scope, token string
+		ok                    bool
+	}{
+		{"alice", "b", "t1", false},
+		{"bob", "a", "t1", false},
+		{"alice", "a", "t1", true},
+		{"alice", "a", "t1", false},
+		{"alice", "a", "t3", false},
+		{"alice", "b", "t2", true},
+	} {
+		ok, err := s.ValidateScopedAndConsume(tc.session, tc.scope, tc.token)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, tc.ok, ok, tc.session+" "+tc.scope+" "+tc.token)
+	}
+}
+
+// go test -run Test_MemoryStorage_CleanupEvery
+func Test_MemoryStorage_CleanupEvery(t *testing.T) {
+	s := NewMemoryStorageWithCleanup(10).(*memoryStorage)
+	for i := 0; i < 5; i++ {
+		utils.AssertEqual(t, nil, s.Set(fmt.Sprint("expiring", i), []byte{1}, time.Nanosecond))
+	}
+	utils.AssertEqual(t, nil, s.Set("kept", []byte{1}, 0))
+	time.Sleep(time.Millisecond)
+
+	// Never read, so still held until the 10th operation sweeps them
+	for i := 0; i < 3; i++ {
+		_, _ = s.Get("kept")
+	}
+	utils.AssertEqual(t, 6, len(s.data))
+	_, _ = s.Get("kept")
+	utils.AssertEqual(t, 1, len(s.data))
+}
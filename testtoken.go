@@ -0,0 +1,15 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+//go:build csrf_testtoken
+// +build csrf_testtoken
+
+package csrf
+
+// TestToken is accepted as a valid token by every middleware instance. It is
+// only compiled in with the csrf_testtoken build tag, for CI integration
+// tests; never ship a binary built with that tag.
+const TestToken = "csrf-test-token"
+
+const testToken = TestToken
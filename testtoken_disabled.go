@@ -0,0 +1,11 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+//go:build !csrf_testtoken
+// +build !csrf_testtoken
+
+package csrf
+
+// testToken is empty in normal builds, see TestToken in testtoken.go.
+const testToken = ""
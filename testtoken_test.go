@@ -0,0 +1,31 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber"
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_CSRF_TestToken
+// go test -tags csrf_testtoken -run Test_CSRF_TestToken
+func Test_CSRF_TestToken(t *testing.T) {
+	app := fiber.New()
+	app.Use(New())
+	app.Post("/", func(c *fiber.Ctx) {})
+
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("X-CSRF-Token", "csrf-test-token")
+	resp, err := app.Test(req)
+	utils.AssertEqual(t, nil, err, "app.Test(req)")
+	if testToken != "" {
+		utils.AssertEqual(t, fiber.StatusOK, resp.StatusCode)
+	} else {
+		utils.AssertEqual(t, fiber.StatusForbidden, resp.StatusCode)
+	}
+}
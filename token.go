@@ -0,0 +1,366 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Generator generates a random token, reading randomness from rand.
+type Generator func(rand io.Reader, now time.Time) (string, error)
+
+// UUIDGenerator generates a random UUID (RFC4122 v4). It is the default.
+func UUIDGenerator(r io.Reader, _ time.Time) (string, error) {
+	var uuid [16]byte
+	if _, err := io.ReadFull(r, uuid[:]); err != nil {
+		return "", err
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = uuid[8]&0x3f | 0x80
+
+	b := make([]byte, 36)
+	hex.Encode(b[0:8], uuid[0:4])
+	b[8] = '-'
+	hex.Encode(b[9:13], uuid[4:6])
+	b[13] = '-'
+	hex.Encode(b[14:18], uuid[6:8])
+	b[18] = '-'
+	hex.Encode(b[19:23], uuid[8:10])
+	b[23] = '-'
+	hex.Encode(b[24:], uuid[10:])
+	return string(b), nil
+}
+
+// crockford is the Crockford base32 alphabet used by ULIDs.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULIDGenerator generates a ULID: a 48 bit millisecond timestamp followed by
+// 80 random bits, encoded as 26 Crockford base32 characters. ULIDs sort by
+// issue time, which helps ordering issuance in logs; the random part keeps
+// them unpredictable. ULIDs from the same millisecond are not ordered.
+func ULIDGenerator(r io.Reader, now time.Time) (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(r, u[6:]); err != nil {
+		return "", err
+	}
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		u[i] = byte(ms)
+		ms >>= 8
+	}
+	hi, lo := binary.BigEndian.Uint64(u[:8]), binary.BigEndian.Uint64(u[8:])
+	b := make([]byte, 26)
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(b), nil
+}
+
+// HumanAlphabet holds digits and upper case letters without the easily
+// confused 0, O, 1, I and L, for tokens that are typed in by hand.
+const HumanAlphabet = "23456789ABCDEFGHJKMNPQRSTUVWXYZ"
+
+// minTokenBits is the entropy below which configDefault warns about tokens
+// generated from Alphabet.
+const minTokenBits = 64
+
+// AlphabetGenerator returns a Generator of tokens of length characters drawn
+// uniformly from alphabet, e.g. short codes printed on a receipt or in a QR
+// code. It panics unless alphabet holds 2 to 256 distinct bytes.
+func AlphabetGenerator(alphabet string, length int) Generator {
+	if len(alphabet) < 2 || len(alphabet) > 256 || length <= 0 {
+		panic("csrf: AlphabetGenerator requires 2 to 256 characters and a positive length")
+	}
+	for i := range alphabet {
+		if strings.IndexByte(alphabet[i+1:], alphabet[i]) >= 0 {
+			panic("csrf: AlphabetGenerator requires distinct characters")
+		}
+	}
+	// Bytes at or above limit are rejected so that every character is
+	// equally likely
+	limit := 256 - 256%len(alphabet)
+	return func(r io.Reader, now time.Time) (string, error) {
+		b := make([]byte, 0, length)
+		buf := make([]byte, length)
+		for len(b) < length {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return "", err
+			}
+			for _, v := range buf {
+				if int(v) < limit && len(b) < length {
+					b = append(b, alphabet[int(v)%len(alphabet)])
+				}
+			}
+		}
+		return string(b), nil
+	}
+}
+
+// alphabetBits returns the entropy of a token of length characters drawn
+// uniformly from alphabet.
+func alphabetBits(alphabet string, length int) float64 {
+	return float64(length) * math.Log2(float64(len(alphabet)))
+}
+
+// stripVersion removes a "<version>." marker from token if version is one
+// of versions.
+func stripVersion(token string, versions []string) string {
+	i := strings.IndexByte(token, '.')
+	if i <= 0 {
+		return token
+	}
+	for _, v := range versions {
+		if token[:i] == v {
+			return token[i+1:]
+		}
+	}
+	return token
+}
+
+// generateHMACToken returns a token of the form "<random>.<issued>.<mac>"
+// where issued is the unix time the token was minted at and mac is
+// HMAC-SHA256(secret, session || "<random>.<issued>"). If methods are given,
+// they are appended to random, e.g. "<random>:POST:PUT", and thereby signed.
+func generateHMACToken(r io.Reader, secret []byte, session string, methods []string, now time.Time) (string, error) {
+	var nonce [16]byte
+	if _, err := io.ReadFull(r, nonce[:]); err != nil {
+		return "", err
+	}
+	random := base64.RawURLEncoding.EncodeToString(nonce[:])
+	for _, m := range methods {
+		random += ":" + strings.ToUpper(m)
+	}
+	payload := random + "." + strconv.FormatInt(now.Unix(), 10)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(secret, session, payload)), nil
+}
+
+// bucketToken returns the token of session for the time bucket of the given
+// interval holding now. The payload is prefixed so that bucket tokens can't
+// be confused with the payload of nonce based tokens.
+func bucketToken(secret []byte, session string, now time.Time, interval time.Duration) string {
+	payload := "bucket:" + strconv.FormatInt(now.UnixNano()/int64(interval), 10)
+	return base64.RawURLEncoding.EncodeToString(tokenMAC(secret, session, payload))
+}
+
+// verifyBucketToken reports whether token belongs to session for the current
+// or the previous time bucket.
+func verifyBucketToken(secret []byte, session, token string, now time.Time, interval time.Duration) bool {
+	current := subtle.ConstantTimeCompare([]byte(bucketToken(secret, session, now, interval)), []byte(token))
+	previous := subtle.ConstantTimeCompare([]byte(bucketToken(secret, session, now.Add(-interval), interval)), []byte(token))
+	return current|previous == 1
+}
+
+// verifyHMACToken reports whether token was issued for session.
+func verifyHMACToken(secret []byte, session, token string) bool {
+	token, ok := decompressToken(token)
+	if !ok {
+		return false
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i <= 0 {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(token[i+1:])
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(mac, tokenMAC(secret, session, token[:i]))
+}
+
+// signedTokenWellFormed reports whether token has the structure of a
+// signed token, "<random>.<issued>.<mac>" or a bucket token if bucket is
+// set, without verifying the signature.
+func signedTokenWellFormed(token string, bucket bool) bool {
+	token, ok := decompressToken(token)
+	if !ok {
+		return false
+	}
+	if bucket {
+		mac, err := base64.RawURLEncoding.DecodeString(token)
+		return err == nil && len(mac) == sha256.Size
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] == "" {
+		return false
+	}
+	if _, err := strconv.ParseInt(parts[1], 10, 64); err != nil {
+		return false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(parts[2])
+	return err == nil && len(mac) == sha256.Size
+}
+
+// methodAllowed reports whether a signed token may be used with method. It
+// does not verify the signature. Tokens without methods allow any method.
+func methodAllowed(token, method string) bool {
+	token, ok := decompressToken(token)
+	if !ok {
+		return false
+	}
+	if i := strings.IndexByte(token, '.'); i >= 0 {
+		token = token[:i]
+	}
+	methods := strings.Split(token, ":")[1:]
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenIssuedAt returns the issue time of a signed token, in UTC. It does
+// not verify the signature.
+func tokenIssuedAt(token string) (time.Time, bool) {
+	token, ok := decompressToken(token)
+	if !ok {
+		return time.Time{}, false
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, false
+	}
+	sec, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(sec, 0).UTC(), true
+}
+
+// maxTokenSize bounds the size of a decompressed token.
+const maxTokenSize = 4096
+
+// compressToken flate-compresses token and marks it with a leading '~'.
+func compressToken(token string) string {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestCompression)
+	_, _ = w.Write([]byte(token))
+	_ = w.Close()
+	return "~" + base64.RawURLEncoding.EncodeToString(buf.Bytes())
+}
+
+// decompressToken reverses compressToken. Tokens without the marker are
+// returned as is.
+func decompressToken(token string) (string, bool) {
+	if !strings.HasPrefix(token, "~") {
+		return token, true
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token[1:])
+	if err != nil {
+		return "", false
+	}
+	r := flate.NewReader(bytes.NewReader(raw))
+	defer r.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(r, maxTokenSize+1))
+	if err != nil || len(out) > maxTokenSize {
+		return "", false
+	}
+	return string(out), true
+}
+
+// deriveKey derives the signing key of a session from a master key with
+// HKDF-SHA256 (RFC5869), using no salt and the session as info. One block
+// of output is all a HMAC-SHA256 key needs.
+func deriveKey(master []byte, session string) []byte {
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	_, _ = extract.Write(master)
+	expand := hmac.New(sha256.New, extract.Sum(nil))
+	_, _ = expand.Write([]byte("csrf session key:" + session))
+	_, _ = expand.Write([]byte{1})
+	return expand.Sum(nil)
+}
+
+// tokenMAC computes HMAC-SHA256(secret, session || payload). The session is
+// length-prefixed so that no two (session, payload) pairs share an input.
+func tokenMAC(secret []byte, session, payload string) []byte {
+	h := hmac.New(sha256.New, secret)
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], uint64(len(session)))
+	_, _ = h.Write(n[:])
+	_, _ = h.Write([]byte(session))
+	_, _ = h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+// SignEdgeToken returns the value an edge worker sets in EdgeTokenHeader to
+// hand out token: the token and its signature with secret, separated by a
+// dot. Edge workers in other languages compute the signature as the
+// unpadded base64url encoded HMAC-SHA256 of "edge:" followed by the token.
+func SignEdgeToken(secret []byte, token string) string {
+	return token + "." + base64.RawURLEncoding.EncodeToString(edgeMAC(secret, token))
+}
+
+// verifyEdgeToken returns the token of a value produced by SignEdgeToken.
+func verifyEdgeToken(secret []byte, value string) (string, bool) {
+	i := strings.LastIndexByte(value, '.')
+	if i <= 0 {
+		return "", false
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil || !hmac.Equal(mac, edgeMAC(secret, value[:i])) {
+		return "", false
+	}
+	return value[:i], true
+}
+
+// edgeMAC computes the signature of an edge token.
+func edgeMAC(secret []byte, token string) []byte {
+	h := hmac.New(sha256.New, secret)
+	_, _ = h.Write([]byte("edge:" + token))
+	return h.Sum(nil)
+}
+
+// base64Encodings are the base64 variants a client may re-encode a token in.
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+}
+
+// compareDecoded reports whether clientToken, in hex or any base64 variant,
+// decodes to the same bytes as expected in encoding. Every decoding of
+// clientToken is compared, so that timing doesn't tell which one matched.
+func compareDecoded(encoding, expected, clientToken string) bool {
+	var want []byte
+	if encoding == "hex" {
+		want, _ = hex.DecodeString(expected)
+	} else {
+		for _, enc := range base64Encodings {
+			if b, err := enc.DecodeString(expected); err == nil {
+				want = b
+				break
+			}
+		}
+	}
+	if len(want) == 0 {
+		return false
+	}
+	valid := false
+	if got, err := hex.DecodeString(clientToken); err == nil && subtle.ConstantTimeCompare(want, got) == 1 {
+		valid = true
+	}
+	for _, enc := range base64Encodings {
+		if got, err := enc.DecodeString(clientToken); err == nil && subtle.ConstantTimeCompare(want, got) == 1 {
+			valid = true
+		}
+	}
+	return valid
+}
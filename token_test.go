@@ -0,0 +1,130 @@
+// 🚀 Fiber is an Express inspired web framework written in Go with 💖
+// 📌 API Documentation: https://fiber.wiki
+// 📝 Github Repository: https://github.com/gofiber/fiber
+
+package csrf
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/utils"
+)
+
+// go test -run Test_CompressToken
+func Test_CompressToken(t *testing.T) {
+	large := strings.Repeat("scope=checkout.session=alice.kid=2020-09.", 8)
+	compressed := compressToken(large)
+	utils.AssertEqual(t, true, len(compressed) < len(large))
+
+	out, ok := decompressToken(compressed)
+	utils.AssertEqual(t, true, ok)
+	utils.AssertEqual(t, large, out)
+
+	_, ok = decompressToken("~not-flate")
+	utils.AssertEqual(t, false, ok)
+
+	_, ok = decompressToken(compressToken(strings.Repeat("a", maxTokenSize+1)))
+	utils.AssertEqual(t, false, ok)
+}
+
+// go test -run Test_ULIDGenerator
+func Test_ULIDGenerator(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	var prev string
+	for i := 0; i < 100; i++ {
+		id, err := ULIDGenerator(rand.Reader, now)
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, 26, len(id))
+		for _, r := range id {
+			utils.AssertEqual(t, true, strings.ContainsRune(crockford, r), id)
+		}
+		utils.AssertEqual(t, true, id > prev, id+" > "+prev)
+		prev = id
+		now = now.Add(time.Millisecond)
+	}
+
+	// Known encoding of the timestamp part
+	id, _ := ULIDGenerator(bytes.NewReader(make([]byte, 10)), time.Unix(0, 0).Add(1469918176385*time.Millisecond))
+	utils.AssertEqual(t, "01ARYZ6S410000000000000000", id)
+
+	a, _ := ULIDGenerator(rand.Reader, now)
+	b, _ := ULIDGenerator(rand.Reader, now)
+	utils.AssertEqual(t, a[:10], b[:10])
+	utils.AssertEqual(t, true, a[10:] != b[10:])
+}
+
+// go test -run Test_AlphabetGenerator
+func Test_AlphabetGenerator(t *testing.T) {
+	generate := AlphabetGenerator(HumanAlphabet, 12)
+	for i := 0; i < 100; i++ {
+		token, err := generate(rand.Reader, time.Now())
+		utils.AssertEqual(t, nil, err)
+		utils.AssertEqual(t, 12, len(token))
+		for _, r := range token {
+			utils.AssertEqual(t, true, strings.ContainsRune(HumanAlphabet, r), token)
+		}
+	}
+	utils.AssertEqual(t, false, strings.ContainsAny(HumanAlphabet, "0O1IL"))
+
+	var logged []map[string]interface{}
+	logger := func(msg string, fields map[string]interface{}) {
+		logged = append(logged, fields)
+	}
+	cfg := configDefault(Config{Alphabet: HumanAlphabet, TokenLength: 8, Logger: logger})
+	token, err := cfg.Generator(cfg.RandReader, time.Now())
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, 8, len(token))
+	utils.AssertEqual(t, []map[string]interface{}{{"bits": 39}}, logged)
+
+	logged = nil
+	configDefault(Config{Alphabet: HumanAlphabet, TokenLength: 16, Logger: logger})
+	utils.AssertEqual(t, 0, len(logged))
+}
+
+// go test -run Test_DeriveKey
+func Test_DeriveKey(t *testing.T) {
+	master := []byte("secret")
+	alice := deriveKey(master, "alice")
+	utils.AssertEqual(t, alice, deriveKey(master, "alice"))
+	utils.AssertEqual(t, 32, len(alice))
+	utils.AssertEqual(t, false, bytes.Equal(alice, deriveKey(master, "bob")))
+	utils.AssertEqual(t, false, bytes.Equal(alice, deriveKey([]byte("other"), "alice")))
+
+	// Tokens signed with a derived key only validate under that key
+	token, err := generateHMACToken(rand.Reader, alice, "alice", nil, time.Now())
+	utils.AssertEqual(t, nil, err)
+	utils.AssertEqual(t, true, verifyHMACToken(alice, "alice", token))
+	utils.AssertEqual(t, false, verifyHMACToken(deriveKey(master, "bob"), "alice", token))
+	utils.AssertEqual(t, false, verifyHMACToken(master, "alice", token))
+}
+
+// go test -run Test_CompareDecoded
+func Test_CompareDecoded(t *testing.T) {
+	raw := []byte{0xde, 0xad, 0xbe, 0xef, 0xfb, 0xff}
+	hexToken := hex.EncodeToString(raw)
+	b64Token := base64.StdEncoding.EncodeToString(raw)
+	testCases := []struct {
+		encoding, expected, client string
+		valid                      bool
+	}{
+		{"hex", hexToken, hexToken, true},
+		{"hex", hexToken, strings.ToUpper(hexToken), true},
+		{"hex", hexToken, b64Token, true},
+		{"hex", hexToken, base64.RawURLEncoding.EncodeToString(raw), true},
+		{"base64", b64Token, hexToken, true},
+		{"base64", b64Token, base64.URLEncoding.EncodeToString(raw), true},
+		{"hex", hexToken, hex.EncodeToString(raw[:5]), false},
+		{"hex", hexToken, base64.StdEncoding.EncodeToString(append(raw, 0)), false},
+		{"hex", hexToken, "not a token", false},
+		{"hex", "", "", false},
+	}
+	for _, tc := range testCases {
+		utils.AssertEqual(t, tc.valid, compareDecoded(tc.encoding, tc.expected, tc.client), tc.client)
+	}
+}